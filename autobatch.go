@@ -0,0 +1,109 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WithAutoBatch transparently merges Run calls made within window of each
+// other into a single batched request, as sent by RunBatch. A batch is sent
+// as soon as it holds maxSize operations. Only requests with the same
+// headers are batched together, and requests with files are never batched.
+// The server must support array batching.
+func WithAutoBatch(window time.Duration, maxSize int) ClientOption {
+	return func(client *clientImp) {
+		b := &autoBatcher{client: client}
+		b.batches = newCollector(window, maxSize, b.send)
+		client.batcher = b
+	}
+}
+
+type autoBatcher struct {
+	client *clientImp
+	// batches collects the calls, by request headers.
+	batches *collector
+}
+
+// batchCall is a single Run call waiting for its batch to be sent.
+type batchCall struct {
+	req  *Request
+	data json.RawMessage
+	err  error
+	done chan struct{}
+}
+
+// run queues req in the current batch and waits for its result.
+func (b *autoBatcher) run(ctx context.Context, req *Request, resp interface{}) error {
+	call := &batchCall{
+		req:  req,
+		done: make(chan struct{}),
+	}
+	b.batches.add(headerKey(req.Header), call)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.done:
+	}
+	if resp != nil && len(call.data) > 0 {
+		if err := b.client.decodeData(call.data, resp); err != nil && call.err == nil {
+			return err
+		}
+	}
+	return call.err
+}
+
+// send runs the calls as one batch and hands each caller its result.
+func (b *autoBatcher) send(ctx context.Context, items []interface{}) {
+	calls := make([]*batchCall, len(items))
+	for i, item := range items {
+		calls[i] = item.(*batchCall)
+	}
+	defer func() {
+		for _, call := range calls {
+			close(call.done)
+		}
+	}()
+	if len(calls) == 1 {
+		calls[0].err = b.client.runWithJSON(ctx, calls[0].req, &calls[0].data)
+		return
+	}
+	b.client.logf("(autoBatch) sending %d operations", len(calls))
+	reqs := make([]*Request, len(calls))
+	resps := make([]interface{}, len(calls))
+	for i, call := range calls {
+		reqs[i] = call.req
+		resps[i] = &call.data
+	}
+	err := b.client.RunBatch(ctx, reqs, resps)
+	batchErr, isBatchErr := err.(*BatchError)
+	for i, call := range calls {
+		if isBatchErr {
+			call.err = batchErr.Errors[i]
+		} else {
+			call.err = err
+		}
+	}
+}
+
+// headerKey is a canonical representation of header.
+func headerKey(header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(header[key], ", "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
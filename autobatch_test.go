@@ -0,0 +1,92 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func newBatchEchoServer(t *testing.T, sizes *[]int) *httptest.Server {
+	is := is.New(t)
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ops []batchOperation
+		is.NoErr(json.NewDecoder(r.Body).Decode(&ops))
+		mu.Lock()
+		*sizes = append(*sizes, len(ops))
+		mu.Unlock()
+		results := make([]interface{}, len(ops))
+		for i, op := range ops {
+			results[i] = map[string]interface{}{
+				"data": map[string]interface{}{"value": op.Variables["id"]},
+			}
+		}
+		is.NoErr(json.NewEncoder(w).Encode(results))
+	}))
+}
+
+func TestAutoBatch(t *testing.T) {
+	is := is.New(t)
+	var sizes []int
+	srv := newBatchEchoServer(t, &sizes)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithAutoBatch(50*time.Millisecond, 100))
+
+	var wg sync.WaitGroup
+	values := make([]string, 10)
+	errs := make([]error, 10)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := NewRequest("query ($id: ID!) { item(id: $id) { value } }")
+			req.Var("id", fmt.Sprint(i))
+			var resp struct {
+				Value string
+			}
+			errs[i] = client.Run(ctx, req, &resp)
+			values[i] = resp.Value
+		}(i)
+	}
+	wg.Wait()
+
+	is.Equal(sizes, []int{10})
+	for i := range values {
+		is.NoErr(errs[i])
+		is.Equal(values[i], fmt.Sprint(i))
+	}
+}
+
+func TestAutoBatchMaxSize(t *testing.T) {
+	is := is.New(t)
+	var sizes []int
+	srv := newBatchEchoServer(t, &sizes)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithAutoBatch(time.Minute, 2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := NewRequest("query ($id: ID!) { item(id: $id) { value } }")
+			req.Var("id", fmt.Sprint(i))
+			is.NoErr(client.Run(ctx, req, nil))
+		}(i)
+	}
+	wg.Wait()
+	is.Equal(sizes, []int{2, 2})
+}
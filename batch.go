@@ -0,0 +1,233 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// batchOperation is a single operation in a batched request body.
+type batchOperation struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// RunBatch sends all requests as a JSON array in a single HTTP request and
+// unmarshals each result into the response object at the same index.
+// Pass a nil resps, or nil entries in it, to skip response parsing.
+// The retry policy applies to the batch as a whole; use
+// WithBatchRetryFailedOnly to re-send only the operations that failed.
+// If any operation fails, a *BatchError is returned.
+func (c *clientImp) RunBatch(ctx context.Context, reqs []*Request, resps []interface{}) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if resps != nil && len(resps) != len(reqs) {
+		return fmt.Errorf("batch has %d requests but %d responses", len(reqs), len(resps))
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	br := &batchResponse{
+		reqs:       reqs,
+		entries:    make([]*graphResponse, len(reqs)),
+		pending:    make([]int, len(reqs)),
+		failedOnly: c.retryFailedBatchOps,
+		encode:     c.encodeBatch,
+		unmarshal:  c.unmarshal,
+		decodeData: c.decodeData,
+	}
+	header := make(http.Header)
+	for i, req := range reqs {
+		if len(req.files) > 0 || hasUploadVars(req) {
+			return errors.New("cannot send files in a batch")
+		}
+		br.entries[i] = &graphResponse{}
+		if resps != nil {
+			br.entries[i].Data = resps[i]
+		}
+		br.pending[i] = i
+		for key, values := range req.Header {
+			for _, value := range values {
+				header.Add(key, value)
+			}
+		}
+	}
+
+	body, contentEncoding, err := c.encodeBatch(reqs)
+	if err != nil {
+		return err
+	}
+	c.logf(">> batch: %d operations", len(reqs))
+	r, err := http.NewRequest(http.MethodPost, c.endpoint, body)
+	if err != nil {
+		return err
+	}
+	if contentEncoding != "" {
+		r.Header.Set("Content-Encoding", contentEncoding)
+	}
+	r = c.prepareRequest(r, "application/json; charset=utf-8", header)
+
+	err = c.executeRequest(br, r)
+	if errBatch := br.err(); errBatch != nil {
+		return errBatch
+	}
+	return err
+}
+
+// encodeBatch encodes reqs as a JSON array, compressing it if enabled.
+func (c *clientImp) encodeBatch(reqs []*Request) (*bytes.Buffer, string, error) {
+	ops := make([]batchOperation, len(reqs))
+	for i, req := range reqs {
+		ops[i] = batchOperation{Query: req.q, Variables: req.vars}
+	}
+	b, err := c.codec.Marshal(ops)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "encode body")
+	}
+	// ended by a newline, as json.Encoder does
+	return c.compressBody(bytes.NewBuffer(append(b, '\n')))
+}
+
+// WithBatchRetryFailedOnly makes RunBatch re-send only the operations whose
+// errors are retryable, instead of the whole batch. Failures at the HTTP
+// level still re-send every outstanding operation.
+func WithBatchRetryFailedOnly() ClientOption {
+	return func(client *clientImp) {
+		client.retryFailedBatchOps = true
+	}
+}
+
+// batchResponse decodes the array response of a batched request.
+type batchResponse struct {
+	reqs    []*Request
+	entries []*graphResponse
+	// pending holds the indexes of the operations sent in the current attempt.
+	pending []int
+	// decoded is set once the current attempt produced per-operation results.
+	decoded    bool
+	failedOnly bool
+	encode     func(reqs []*Request) (*bytes.Buffer, string, error)
+	// unmarshal and decodeData decode the response with the codec and
+	// decoding options of the client.
+	unmarshal  func(b []byte, v interface{}) error
+	decodeData func(data json.RawMessage, v interface{}) error
+}
+
+// decode decodes the body of the response into the entries pending.
+func (b *batchResponse) decode(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		// The server rejected the batch as a whole, or does not support
+		// batching: report its errors against every operation.
+		var gr graphResponse
+		if err := b.unmarshal(trimmed, &gr); err != nil {
+			return err
+		}
+		if len(gr.Errors) == 0 {
+			return errors.New("expected an array response to a batched request")
+		}
+		for _, i := range b.pending {
+			b.entries[i].Errors = gr.Errors
+		}
+		return nil
+	}
+	var results []json.RawMessage
+	if err := b.unmarshal(trimmed, &results); err != nil {
+		return err
+	}
+	if len(results) != len(b.pending) {
+		return fmt.Errorf("batched response has %d results, expected %d", len(results), len(b.pending))
+	}
+	for j, result := range results {
+		entry := b.entries[b.pending[j]]
+		var envelope struct {
+			Data   json.RawMessage `json:"data"`
+			Errors []GraphQLError  `json:"errors"`
+		}
+		err := b.unmarshal(result, &envelope)
+		if err == nil {
+			entry.Errors = envelope.Errors
+			err = b.decodeData(envelope.Data, entry.Data)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "decode operation %d", b.pending[j])
+		}
+	}
+	b.decoded = true
+	return nil
+}
+
+func (b *batchResponse) reset() {
+	b.decoded = false
+	for _, i := range b.pending {
+		b.entries[i].reset()
+	}
+}
+
+func (b *batchResponse) err() error {
+	var failed bool
+	errs := make([]error, len(b.entries))
+	for i, entry := range b.entries {
+		if errs[i] = entry.err(); errs[i] != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+	return &BatchError{Errors: errs}
+}
+
+func (b *batchResponse) retryable() bool {
+	for _, i := range b.pending {
+		if b.entries[i].retryable() {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *batchResponse) prepareRetry(r *http.Request) (bool, error) {
+	if !b.failedOnly || !b.decoded {
+		return false, nil
+	}
+	var pending []int
+	for _, i := range b.pending {
+		if b.entries[i].retryable() {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == len(b.pending) {
+		return false, nil
+	}
+	b.pending = pending
+	reqs := make([]*Request, len(pending))
+	for j, i := range pending {
+		reqs[j] = b.reqs[i]
+	}
+	body, contentEncoding, err := b.encode(reqs)
+	if err != nil {
+		return false, err
+	}
+	// the http.Client may replay the body too, on redirects for instance
+	narrowed := body.Bytes()
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(narrowed)), nil
+	}
+	r.ContentLength = int64(len(narrowed))
+	r.Header.Del("Content-Encoding")
+	if contentEncoding != "" {
+		r.Header.Set("Content-Encoding", contentEncoding)
+	}
+	return true, nil
+}
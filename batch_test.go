@@ -0,0 +1,118 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRunBatch(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("X-Custom-Header"), "123")
+		var ops []batchOperation
+		is.NoErr(json.NewDecoder(r.Body).Decode(&ops))
+		is.Equal(len(ops), 2)
+		is.Equal(ops[0].Query, "query ($id: ID!) { item(id: $id) { value } }")
+		is.Equal(ops[1].Variables["id"], "2")
+		io.WriteString(w, `[
+			{"data": {"value": "one"}},
+			{"data": null, "errors": [{"name": "not_found", "message": "no item 2"}]}
+		]`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	var reqs []*Request
+	for _, id := range []string{"1", "2"} {
+		req := NewRequest("query ($id: ID!) { item(id: $id) { value } }")
+		req.Var("id", id)
+		reqs = append(reqs, req)
+	}
+	reqs[0].Header.Set("X-Custom-Header", "123")
+	var first, second struct {
+		Value string
+	}
+	err := client.RunBatch(ctx, reqs, []interface{}{&first, &second})
+	is.Equal(calls, 1)
+	is.Equal(first.Value, "one")
+	batchErr, ok := err.(*BatchError)
+	is.True(ok)
+	is.Equal(len(batchErr.Errors), 2)
+	is.NoErr(batchErr.Errors[0])
+	is.True(batchErr.Errors[1] != nil)
+}
+
+func TestRunBatchRejected(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"errors": [{"message": "batching is not supported"}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	err := client.RunBatch(ctx, []*Request{NewRequest("{ a }"), NewRequest("{ b }")}, nil)
+	batchErr, ok := err.(*BatchError)
+	is.True(ok)
+	is.True(batchErr.Errors[0] != nil)
+	is.True(batchErr.Errors[1] != nil)
+}
+
+func TestRunBatchRetryFailedOnly(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ops []batchOperation
+		is.NoErr(json.NewDecoder(r.Body).Decode(&ops))
+		sizes = append(sizes, len(ops))
+		if len(ops) == 2 {
+			io.WriteString(w, `[
+				{"data": {"value": "one"}},
+				{"errors": [{"name": "service_unavailable", "message": "try again"}]}
+			]`)
+			return
+		}
+		is.Equal(ops[0].Query, "{ second }")
+		if r.URL.Path != "/moved" {
+			// the http.Client replays the body of the retry
+			http.Redirect(w, r, "/moved", http.StatusTemporaryRedirect)
+			return
+		}
+		io.WriteString(w, `[{"data": {"value": "two"}}]`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTestDuration(2))
+	defer cancel()
+	retryConfig := RetryConfig{
+		MaxTries: 2,
+		Interval: 1,
+		Policy:   Linear,
+	}
+	client := NewClient(srv.URL, WithRetryConfig(retryConfig), WithBatchRetryFailedOnly())
+
+	var first, second struct {
+		Value string
+	}
+	err := client.RunBatch(ctx, []*Request{NewRequest("{ first }"), NewRequest("{ second }")}, []interface{}{&first, &second})
+	is.NoErr(err)
+	is.Equal(sizes, []int{2, 1, 1})
+	is.Equal(first.Value, "one")
+	is.Equal(second.Value, "two")
+}
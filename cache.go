@@ -0,0 +1,370 @@
+package graphql
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultCacheSize = 1000
+
+// CacheStore stores query responses for the response cache.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+// CacheEntry is a cached query response along with the validators needed
+// to revalidate it with the server.
+type CacheEntry struct {
+	Body         []byte      `json:"body"`
+	Header       http.Header `json:"header"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	Expires      time.Time   `json:"expires"`
+}
+
+// fresh reports whether the entry can be served without contacting the server.
+func (e *CacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// response builds a synthetic 200 response serving the cached body.
+func (e *CacheEntry) response(req *http.Request) *http.Response {
+	header := make(http.Header, len(e.Header))
+	for key, values := range e.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// newCacheEntry reads the caching headers of a response. It returns false if
+// the response must not be stored: either the server forbids it or there is
+// neither a freshness lifetime nor a validator to revalidate with.
+func newCacheEntry(header http.Header, now time.Time) (*CacheEntry, bool) {
+	entry := &CacheEntry{
+		Header:       header,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Expires:      now,
+	}
+	hasLifetime := false
+	cacheControl := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := cacheControl["no-store"]; ok {
+		return nil, false
+	}
+	if _, ok := cacheControl["no-cache"]; ok {
+		hasLifetime = false
+	} else if maxAge, ok := cacheControl["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil {
+			entry.Expires = now.Add(time.Duration(seconds) * time.Second)
+			hasLifetime = seconds > 0
+		}
+	} else if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil && t.After(now) {
+			entry.Expires = t
+			hasLifetime = true
+		}
+	}
+	if !hasLifetime && entry.ETag == "" && entry.LastModified == "" {
+		return nil, false
+	}
+	return entry, true
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, arg = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = arg
+	}
+	return directives
+}
+
+type cacheKeyContextKey struct{}
+
+// requestKey identifies a request by endpoint, document, variables and the
+// headers it is sent with, the default headers of the client included, so
+// responses for different credentials never mix, even in a store shared by
+// several clients.
+func (c *clientImp) requestKey(req *Request) (string, error) {
+	vars, err := json.Marshal(req.vars)
+	if err != nil {
+		return "", errors.Wrap(err, "encode variables")
+	}
+	header := make(http.Header, len(c.defaultHeaders)+len(req.Header))
+	for key, value := range c.defaultHeaders {
+		header.Add(key, value)
+	}
+	for key, values := range req.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte(c.endpoint))
+	h.Write([]byte{0})
+	h.Write([]byte(req.q))
+	h.Write([]byte{0})
+	h.Write(vars)
+	h.Write([]byte{0})
+	h.Write([]byte(headerKey(header)))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// withCacheKey marks r as cacheable under the key of req, if the client has a
+// response cache and req is a query.
+func (c *clientImp) withCacheKey(r *http.Request, req *Request) (*http.Request, error) {
+	if c.cache == nil || len(req.files) > 0 || hasUploadVars(req) || operationType(req.q) != "query" {
+		return r, nil
+	}
+	key, err := c.requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), cacheKeyContextKey{}, key)), nil
+}
+
+// do sends the request through the http.Client, serving and revalidating
+// responses from the response cache when the request carries a cache key.
+func (c *clientImp) do(r *http.Request) (*http.Response, error) {
+	key, _ := r.Context().Value(cacheKeyContextKey{}).(string)
+	if c.cache == nil || key == "" {
+		return c.send(r)
+	}
+
+	now := time.Now()
+	cached, ok := c.cache.Get(key)
+	if ok && cached.fresh(now) {
+		c.logf("(cache) hit: %s", key)
+		return cached.response(r), nil
+	}
+	if ok {
+		if cached.ETag != "" {
+			r.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			r.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.send(r)
+	if err != nil {
+		return resp, err
+	}
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		c.logf("(cache) revalidated: %s", key)
+		revalidated := *cached
+		if entry, cacheable := newCacheEntry(resp.Header, now); cacheable {
+			revalidated.Expires = entry.Expires
+		}
+		c.cache.Set(key, &revalidated)
+		return revalidated.response(r), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	entry, cacheable := newCacheEntry(resp.Header, now)
+	if !cacheable {
+		if ok {
+			c.cache.Delete(key)
+		}
+		return resp, nil
+	}
+	var src io.Reader = resp.Body
+	if c.maxResponseSize > 0 {
+		src = io.LimitReader(resp.Body, c.maxResponseSize+1)
+	}
+	body, err := ioutil.ReadAll(src)
+	if err != nil {
+		resp.Body.Close()
+		return nil, errors.Wrap(err, "read response for cache")
+	}
+	if c.maxResponseSize > 0 && int64(len(body)) > c.maxResponseSize {
+		// too large to be cached, and left for decoding to fail
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// Never cache a response carrying GraphQL errors, otherwise retries of a
+	// failed query would be served the same failure.
+	var envelope struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if json.Unmarshal(body, &envelope) != nil || len(envelope.Errors) > 0 {
+		return resp, nil
+	}
+	entry.Body = body
+	c.cache.Set(key, entry)
+	return resp, nil
+}
+
+// WithResponseCache caches query responses in store, honouring the
+// Cache-Control and Expires headers of the server and revalidating stale
+// entries with If-None-Match and If-Modified-Since. Mutations,
+// subscriptions and requests with files are never cached.
+func WithResponseCache(store CacheStore) ClientOption {
+	return func(client *clientImp) {
+		client.cache = store
+	}
+}
+
+// WithDefaultResponseCache caches query responses in an in-memory LRU cache.
+func WithDefaultResponseCache() ClientOption {
+	return WithResponseCache(NewLRUCache(defaultCacheSize))
+}
+
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewLRUCache makes an in-memory CacheStore holding at most capacity
+// entries, evicting the least recently used entry when full.
+func NewLRUCache(capacity int) CacheStore {
+	if capacity <= 0 {
+		capacity = defaultCacheSize
+	}
+	return &lruCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (l *lruCache) Get(key string) (*CacheEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return elem.Value.(*lruItem).entry, true
+}
+
+func (l *lruCache) Set(key string, entry *CacheEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		elem.Value.(*lruItem).entry = entry
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruItem{key: key, entry: entry})
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruItem).key)
+	}
+}
+
+func (l *lruCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+	}
+}
+
+type diskCache struct {
+	dir string
+}
+
+// NewDiskCache makes a CacheStore that keeps one JSON file per entry in dir,
+// so cached responses survive process restarts.
+func NewDiskCache(dir string) (CacheStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "create cache dir")
+	}
+	return &diskCache{dir: dir}, nil
+}
+
+func (d *diskCache) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
+
+func (d *diskCache) Get(key string) (*CacheEntry, bool) {
+	b, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (d *diskCache) Set(key string, entry *CacheEntry) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(d.dir, key+".tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+func (d *diskCache) Delete(key string) {
+	os.Remove(d.path(key))
+}
@@ -0,0 +1,216 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestResponseCacheMaxAge(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithDefaultResponseCache())
+
+	for i := 0; i < 3; i++ {
+		req := NewRequest("query ($id: ID!) { item(id: $id) { value } }")
+		req.Var("id", "1")
+		var resp struct {
+			Value string
+		}
+		is.NoErr(client.Run(ctx, req, &resp))
+		is.Equal(resp.Value, "some data")
+	}
+	is.Equal(calls, 1) // served from cache
+
+	req := NewRequest("query ($id: ID!) { item(id: $id) { value } }")
+	req.Var("id", "2")
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 2) // different variables
+}
+
+func TestResponseCacheSharedStore(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, `{"data":{"user":"`+r.Header.Get("Authorization")+`"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	store := NewLRUCache(10)
+	alice := NewClient(srv.URL, WithResponseCache(store), WithDefaultHeaders(map[string]string{"Authorization": "alice"}))
+	bob := NewClient(srv.URL, WithResponseCache(store), WithDefaultHeaders(map[string]string{"Authorization": "bob"}))
+
+	for _, client := range []Client{alice, bob, alice, bob} {
+		var resp struct {
+			User string
+		}
+		is.NoErr(client.Run(ctx, NewRequest("query { user }"), &resp))
+		if client == alice {
+			is.Equal(resp.User, "alice")
+		} else {
+			is.Equal(resp.User, "bob")
+		}
+	}
+	is.Equal(calls, 2) // once per credentials
+}
+
+func TestResponseCacheRevalidate(t *testing.T) {
+	is := is.New(t)
+	var calls, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithDefaultResponseCache())
+
+	for i := 0; i < 2; i++ {
+		var resp struct {
+			Value string
+		}
+		is.NoErr(client.Run(ctx, NewRequest("{ value }"), &resp))
+		is.Equal(resp.Value, "some data")
+	}
+	is.Equal(calls, 2)
+	is.Equal(notModified, 1)
+}
+
+func TestResponseCacheSkipsMutationsAndErrors(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) == `{"query":"query { broken }","variables":null}`+"\n" {
+			io.WriteString(w, `{"errors":[{"name":"not_found","message":"nope"}]}`)
+			return
+		}
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithDefaultResponseCache())
+
+	is.NoErr(client.Run(ctx, NewRequest("mutation { update }"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("mutation { update }"), nil))
+	is.Equal(calls, 2)
+
+	is.True(client.Run(ctx, NewRequest("query { broken }"), nil) != nil)
+	is.True(client.Run(ctx, NewRequest("query { broken }"), nil) != nil)
+	is.Equal(calls, 4)
+}
+
+func TestResponseCacheSkipsUploads(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		file, _, err := r.FormFile("0")
+		is.NoErr(err)
+		b, err := ioutil.ReadAll(file)
+		is.NoErr(err)
+		io.WriteString(w, `{"data":{"value":"`+string(b)+`"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec(), WithDefaultResponseCache())
+
+	for _, contents := range []string{"AAA", "BBB"} {
+		req := NewRequest("query ($f: Upload!) { checksum(file: $f) }")
+		req.Var("f", Upload{Name: "f.txt", R: strings.NewReader(contents)})
+		var resp struct {
+			Value string
+		}
+		is.NoErr(client.Run(ctx, req, &resp))
+		is.Equal(resp.Value, contents)
+	}
+	is.Equal(calls, 2) // requests with files are never cached
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	is := is.New(t)
+	cache := NewLRUCache(2)
+	cache.Set("a", &CacheEntry{Body: []byte("a")})
+	cache.Set("b", &CacheEntry{Body: []byte("b")})
+	_, ok := cache.Get("a")
+	is.True(ok)
+	cache.Set("c", &CacheEntry{Body: []byte("c")})
+	_, ok = cache.Get("b")
+	is.True(!ok) // least recently used
+	_, ok = cache.Get("a")
+	is.True(ok)
+	cache.Delete("a")
+	_, ok = cache.Get("a")
+	is.True(!ok)
+}
+
+func TestDiskCache(t *testing.T) {
+	is := is.New(t)
+	dir, err := ioutil.TempDir("", "graphql-cache")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+
+	cache, err := NewDiskCache(dir)
+	is.NoErr(err)
+	expires := time.Now().Add(time.Minute).Round(time.Second)
+	cache.Set("key", &CacheEntry{Body: []byte(`{"data":{}}`), ETag: `"v1"`, Expires: expires})
+
+	reopened, err := NewDiskCache(dir)
+	is.NoErr(err)
+	entry, ok := reopened.Get("key")
+	is.True(ok)
+	is.Equal(string(entry.Body), `{"data":{}}`)
+	is.Equal(entry.ETag, `"v1"`)
+	is.True(entry.Expires.Equal(expires))
+
+	reopened.Delete("key")
+	_, ok = cache.Get("key")
+	is.True(!ok)
+}
+
+func TestOperationType(t *testing.T) {
+	is := is.New(t)
+	is.Equal(operationType(`{ items }`), "query")
+	is.Equal(operationType(`query ($id: ID!) { item(id: $id) }`), "query")
+	is.Equal(operationType(`# comment { }
+		mutation { update }`), "mutation")
+	is.Equal(operationType(`fragment f on Item { id } subscription { changed { ...f } }`), "subscription")
+	is.Equal(operationType(``), "")
+}
@@ -0,0 +1,254 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultChunkSize = 8 << 20
+
+// Chunk is a part of a file uploaded by a ChunkedUpload.
+type Chunk struct {
+	// Index is the position of the chunk among the Count chunks of the file.
+	Index int
+	Count int
+	// Offset is the position of the chunk in the file.
+	Offset int64
+	// File holds the contents of the chunk, to be set as an Upload variable
+	// or added with Request.FileFunc.
+	File File
+}
+
+// ChunkRequestFunc builds the request uploading a chunk. The request must
+// carry the File of the chunk, as an Upload variable or added with
+// Request.FileFunc.
+type ChunkRequestFunc func(chunk Chunk) *Request
+
+// FinalizeRequestFunc builds the request completing an upload, given the
+// response data of the request of each chunk, in order.
+type FinalizeRequestFunc func(chunks []json.RawMessage) *Request
+
+// ChunkedUpload uploads a large file in chunks, each sent as its own
+// request with its own retries. The chunks already uploaded are recorded in
+// a state file, so an upload stopped by an error or a restart of the process
+// resumes where it left off when it is run again. Chunks set as Upload
+// variables need a client created with UseMultipartRequestSpec.
+//
+//	client := graphql.NewClient(endpoint, graphql.UseMultipartRequestSpec())
+//	upload := graphql.NewChunkedUpload(client, "video.mp4", func(chunk graphql.Chunk) *graphql.Request {
+//	    req := graphql.NewRequest(`mutation ($id: ID!, $index: Int!, $chunk: Upload!) { uploadChunk(id: $id, index: $index, chunk: $chunk) { etag } }`)
+//	    req.Var("id", uploadID)
+//	    req.Var("index", chunk.Index)
+//	    req.Var("chunk", graphql.Upload(chunk.File))
+//	    return req
+//	}, completeUpload)
+//	err := upload.Run(ctx, &resp)
+type ChunkedUpload struct {
+	client        Client
+	path          string
+	build         ChunkRequestFunc
+	finalize      FinalizeRequestFunc
+	chunkSize     int64
+	stateFile     string
+	maxTries      int
+	retryInterval time.Duration
+}
+
+// ChunkedUploadOption are functions that are passed into NewChunkedUpload
+// to modify the behaviour of the ChunkedUpload.
+type ChunkedUploadOption func(*ChunkedUpload)
+
+// WithChunkSize sets the size of the chunks, 8MB by default.
+func WithChunkSize(size int64) ChunkedUploadOption {
+	return func(upload *ChunkedUpload) {
+		upload.chunkSize = size
+	}
+}
+
+// WithUploadStateFile sets the file recording the progress of the upload.
+// By default it is the path of the uploaded file followed by .upload.
+func WithUploadStateFile(path string) ChunkedUploadOption {
+	return func(upload *ChunkedUpload) {
+		upload.stateFile = path
+	}
+}
+
+// WithChunkRetries sends the request of a chunk up to maxTries times,
+// waiting interval between tries, on top of the retries of the Client.
+func WithChunkRetries(maxTries int, interval time.Duration) ChunkedUploadOption {
+	return func(upload *ChunkedUpload) {
+		upload.maxTries = maxTries
+		upload.retryInterval = interval
+	}
+}
+
+// NewChunkedUpload makes a new ChunkedUpload of the file at path, whose
+// chunks are uploaded with requests built by build, and which is completed
+// with the request built by finalize.
+func NewChunkedUpload(client Client, path string, build ChunkRequestFunc, finalize FinalizeRequestFunc, opts ...ChunkedUploadOption) *ChunkedUpload {
+	u := &ChunkedUpload{
+		client:    client,
+		path:      path,
+		build:     build,
+		finalize:  finalize,
+		chunkSize: defaultChunkSize,
+		stateFile: path + ".upload",
+		maxTries:  1,
+	}
+	for _, optionFunc := range opts {
+		optionFunc(u)
+	}
+	return u
+}
+
+// uploadState is the content of the state file.
+type uploadState struct {
+	Size      int64                   `json:"size"`
+	ModTime   time.Time               `json:"modTime"`
+	ChunkSize int64                   `json:"chunkSize"`
+	Chunks    map[int]json.RawMessage `json:"chunks"`
+}
+
+// Run uploads the chunks not uploaded yet, then runs the finalize request
+// and unmarshals its response into resp. The state file is removed once the
+// upload is complete. Pass in a nil response object to skip response
+// parsing.
+func (u *ChunkedUpload) Run(ctx context.Context, resp interface{}) error {
+	if u.chunkSize <= 0 {
+		return errors.New("graphql: chunk size must be positive")
+	}
+	info, err := os.Stat(u.path)
+	if err != nil {
+		return errors.Wrap(err, "graphql: chunked upload")
+	}
+	state := u.loadState(info)
+	count := int((info.Size() + u.chunkSize - 1) / u.chunkSize)
+	if count == 0 {
+		count = 1
+	}
+	for index := 0; index < count; index++ {
+		if _, done := state.Chunks[index]; done {
+			continue
+		}
+		data, err := u.upload(ctx, index, count, info.Size())
+		if err != nil {
+			return errors.Wrapf(err, "graphql: chunk %d of %d", index+1, count)
+		}
+		state.Chunks[index] = data
+		if err := u.saveState(state); err != nil {
+			return errors.Wrap(err, "graphql: saving upload state")
+		}
+	}
+	chunks := make([]json.RawMessage, count)
+	for index := range chunks {
+		chunks[index] = state.Chunks[index]
+	}
+	if err := u.client.Run(ctx, u.finalize(chunks), resp); err != nil {
+		return errors.Wrap(err, "graphql: finalize upload")
+	}
+	if err := os.Remove(u.stateFile); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "graphql: removing upload state")
+	}
+	return nil
+}
+
+// upload sends a chunk, trying again up to the maximum number of tries.
+func (u *ChunkedUpload) upload(ctx context.Context, index, count int, size int64) (json.RawMessage, error) {
+	offset := int64(index) * u.chunkSize
+	length := u.chunkSize
+	if offset+length > size {
+		length = size - offset
+	}
+	chunk := Chunk{
+		Index:  index,
+		Count:  count,
+		Offset: offset,
+		File: File{
+			Name: fmt.Sprintf("%s.%d", filepath.Base(u.path), index),
+			Size: length,
+			Open: func() (io.ReadCloser, error) {
+				return openSection(u.path, offset, length)
+			},
+		},
+	}
+	var data json.RawMessage
+	var err error
+	for tryCount := 0; tryCount < u.maxTries; tryCount++ {
+		if tryCount > 0 {
+			timer := time.NewTimer(u.retryInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		req := u.build(chunk)
+		if len(req.files) == 0 && !hasUploadVars(req) {
+			// it would be recorded as uploaded without sending anything
+			return nil, errors.New("request carries no file")
+		}
+		data = nil
+		if err = u.client.Run(ctx, req, &data); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// loadState reads the state file, starting over if it is missing or was
+// written for another version of the file.
+func (u *ChunkedUpload) loadState(info os.FileInfo) *uploadState {
+	fresh := &uploadState{
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		ChunkSize: u.chunkSize,
+		Chunks:    make(map[int]json.RawMessage),
+	}
+	b, err := ioutil.ReadFile(u.stateFile)
+	if err != nil {
+		return fresh
+	}
+	var state uploadState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fresh
+	}
+	if state.Size != fresh.Size || !state.ModTime.Equal(fresh.ModTime) || state.ChunkSize != fresh.ChunkSize || state.Chunks == nil {
+		return fresh
+	}
+	return &state
+}
+
+// saveState replaces the state file, so it is never left half written.
+func (u *ChunkedUpload) saveState(state *uploadState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := u.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.stateFile)
+}
+
+// openSection opens the part of the file at path of length bytes starting
+// at offset.
+func openSection(path string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
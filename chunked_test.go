@@ -0,0 +1,141 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestChunkedUpload(t *testing.T) {
+	is := is.New(t)
+	dir, err := ioutil.TempDir("", "graphql-chunked")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "video.mp4")
+	contents := "0123456789abcdefghijklmnopqrstu"
+	is.NoErr(ioutil.WriteFile(path, []byte(contents), 0600))
+
+	var mu sync.Mutex
+	received := make(map[int]string)
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.FormValue("map") == "" {
+			// finalize, sent as JSON
+			io.WriteString(w, `{"data":{"completeUpload":{"id":"video"}}}`)
+			return
+		}
+		var operations struct {
+			Variables struct {
+				Index int
+			}
+		}
+		is.NoErr(json.Unmarshal([]byte(r.FormValue("operations")), &operations))
+		index := operations.Variables.Index
+		if index == 1 && !failed {
+			failed = true
+			io.WriteString(w, `{"errors":[{"message":"storage unavailable"}]}`)
+			return
+		}
+		file, _, err := r.FormFile("0")
+		is.NoErr(err)
+		b, err := ioutil.ReadAll(file)
+		is.NoErr(err)
+		received[index] = string(b)
+		fmt.Fprintf(w, `{"data":{"uploadChunk":{"etag":"etag-%d"}}}`, index)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec())
+	var etags []string
+	upload := NewChunkedUpload(client, path, func(chunk Chunk) *Request {
+		is.Equal(chunk.Count, 4)
+		req := NewRequest("mutation ($index: Int!, $chunk: Upload!) { uploadChunk(index: $index, chunk: $chunk) { etag } }")
+		req.Var("index", chunk.Index)
+		req.Var("chunk", Upload(chunk.File))
+		return req
+	}, func(chunks []json.RawMessage) *Request {
+		etags = etags[:0]
+		for _, chunk := range chunks {
+			var data struct {
+				UploadChunk struct {
+					Etag string
+				}
+			}
+			is.NoErr(json.Unmarshal(chunk, &data))
+			etags = append(etags, data.UploadChunk.Etag)
+		}
+		req := NewRequest("mutation ($etags: [String!]!) { completeUpload(etags: $etags) { id } }")
+		req.Var("etags", etags)
+		return req
+	}, WithChunkSize(8))
+
+	err = upload.Run(ctx, nil)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "storage unavailable"))
+	is.Equal(len(received), 1)
+	_, err = os.Stat(path + ".upload")
+	is.NoErr(err) // progress is recorded
+
+	// resumes with the chunk that failed
+	received = make(map[int]string)
+	var resp struct {
+		CompleteUpload struct {
+			ID string
+		}
+	}
+	is.NoErr(upload.Run(ctx, &resp))
+	is.Equal(resp.CompleteUpload.ID, "video")
+	is.Equal(len(received), 3)
+	is.Equal(received[1]+received[2]+received[3], contents[8:])
+	is.Equal(etags, []string{"etag-0", "etag-1", "etag-2", "etag-3"})
+	_, err = os.Stat(path + ".upload")
+	is.True(os.IsNotExist(err))
+}
+
+func TestChunkedUploadWithoutFile(t *testing.T) {
+	is := is.New(t)
+	dir, err := ioutil.TempDir("", "graphql-chunked")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "video.mp4")
+	is.NoErr(ioutil.WriteFile(path, []byte("0123456789"), 0600))
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	upload := NewChunkedUpload(NewClient(srv.URL), path, func(chunk Chunk) *Request {
+		req := NewRequest("mutation ($index: Int!) { uploadChunk(index: $index) { etag } }")
+		req.Var("index", chunk.Index)
+		return req
+	}, func(chunks []json.RawMessage) *Request {
+		return NewRequest("mutation { completeUpload { id } }")
+	})
+	err = upload.Run(ctx, nil)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "request carries no file"))
+	is.Equal(calls, 0)
+	_, err = os.Stat(path + ".upload")
+	is.True(os.IsNotExist(err)) // no chunk recorded as uploaded
+}
@@ -0,0 +1,99 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Codec encodes request bodies to JSON and decodes response bodies from
+// JSON. By default encoding/json is used; set another codec, wrapping a
+// faster library for instance, with the WithCodec option.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder decodes a JSON value from a stream. The UseNumber and
+// DisallowUnknownFields options have no effect unless the decoder also has
+// the UseNumber and DisallowUnknownFields methods of json.Decoder.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// WithCodec sets the codec encoding requests and decoding responses.
+//
+//	NewClient(endpoint, WithCodec(myCodec))
+func WithCodec(codec Codec) ClientOption {
+	return func(client *clientImp) {
+		client.codec = codec
+	}
+}
+
+// UseNumber decodes the numbers of the response data into an interface{}
+// as json.Number instead of float64, so large integers such as 64-bit IDs
+// keep their precision.
+func UseNumber() ClientOption {
+	return func(client *clientImp) {
+		client.useNumber = true
+	}
+}
+
+// DisallowUnknownFields makes decoding the response data into a struct fail
+// when the data has a field the struct does not, which catches schema
+// drift in tests. Fields of the response outside its data, such as
+// extensions, are still allowed.
+func DisallowUnknownFields() ClientOption {
+	return func(client *clientImp) {
+		client.disallowUnknownFields = true
+	}
+}
+
+// newDecoder returns a decoder of r with the decoding options of the client.
+func (c *clientImp) newDecoder(r io.Reader) Decoder {
+	decoder := c.codec.NewDecoder(r)
+	if c.useNumber {
+		if d, ok := decoder.(interface{ UseNumber() }); ok {
+			d.UseNumber()
+		}
+	}
+	if c.disallowUnknownFields {
+		if d, ok := decoder.(interface{ DisallowUnknownFields() }); ok {
+			d.DisallowUnknownFields()
+		}
+	}
+	return decoder
+}
+
+// decodeData decodes the data of a response into v, skipping null data and
+// a nil v.
+func (c *clientImp) decodeData(data json.RawMessage, v interface{}) error {
+	if v == nil || !hasData(data) {
+		return nil
+	}
+	return c.newDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// decodeClientData decodes data into v with the codec and decoding options
+// of client, if it was made by NewClient.
+func decodeClientData(client Client, data json.RawMessage, v interface{}) error {
+	if c, ok := client.(*clientImp); ok {
+		return c.decodeData(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// unmarshal decodes b into v with the codec of the client.
+func (c *clientImp) unmarshal(b []byte, v interface{}) error {
+	return c.codec.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
@@ -0,0 +1,184 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// countingCodec is encoding/json counting its uses.
+type countingCodec struct {
+	marshals int
+	decoders int
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshals++
+	return json.Marshal(v)
+}
+
+func (c *countingCodec) NewDecoder(r io.Reader) Decoder {
+	c.decoders++
+	return json.NewDecoder(r)
+}
+
+func TestCodec(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `{"query":"query {}","variables":null}`+"\n")
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	codec := &countingCodec{}
+	client := NewClient(srv.URL, WithCodec(codec))
+
+	var responseData map[string]interface{}
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), &responseData))
+	is.Equal(responseData["value"], "some data")
+	is.Equal(codec.marshals, 1)
+	is.Equal(codec.decoders, 2) // the response, then its data
+}
+
+func TestUseNumber(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"id":9007199254740993}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseNumber())
+
+	var responseData map[string]interface{}
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), &responseData))
+	is.Equal(responseData["id"], json.Number("9007199254740993"))
+
+	resp := &Response{Data: &responseData}
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), resp))
+	is.Equal(responseData["id"], json.Number("9007199254740993"))
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"name":"item","added":true},"extensions":{"cost":1}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var responseData struct {
+		Name string
+	}
+	is.NoErr(NewClient(srv.URL).Run(ctx, NewRequest("query {}"), &responseData))
+	is.Equal(responseData.Name, "item")
+
+	client := NewClient(srv.URL, DisallowUnknownFields())
+	err := client.Run(ctx, NewRequest("query {}"), &responseData)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `unknown field "added"`))
+}
+
+func TestUseNumberRunBatch(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"data":{"id":9007199254740993}},{"data":{"id":1}}]`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseNumber())
+
+	var first, second map[string]interface{}
+	is.NoErr(client.RunBatch(ctx, []*Request{NewRequest("{ first }"), NewRequest("{ second }")}, []interface{}{&first, &second}))
+	is.Equal(first["id"], json.Number("9007199254740993"))
+	is.Equal(second["id"], json.Number("1"))
+
+	// the value picked out by RunMerged is decoded by the client too
+	mergeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"q0_item":{"id":9007199254740993}}}`)
+	}))
+	defer mergeSrv.Close()
+	client = NewClient(mergeSrv.URL, UseNumber())
+	var merged map[string]map[string]interface{}
+	is.NoErr(RunMerged(ctx, client, []*Request{NewRequest("{ item { id } }")}, []interface{}{&merged}))
+	is.Equal(merged["item"]["id"], json.Number("9007199254740993"))
+}
+
+func TestUseNumberLoader(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"a":{"id":9007199254740993}}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseNumber())
+	loader := NewLoader(client, func(keys []string) *Request {
+		return NewRequest("{ a { id } }")
+	}, func(keys []string, data json.RawMessage) (map[string]json.RawMessage, error) {
+		var values map[string]json.RawMessage
+		err := json.Unmarshal(data, &values)
+		return values, err
+	})
+
+	var item map[string]interface{}
+	is.NoErr(loader.Load(ctx, "a", &item))
+	is.Equal(item["id"], json.Number("9007199254740993"))
+}
+
+func TestCodecSubscribeAndRunIncremental(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: next\ndata: {\"data\":{\"id\":9007199254740993}}\n\n")
+			io.WriteString(w, "event: complete\ndata:\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data":{"id":1}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	codec := &countingCodec{}
+	client := NewClient(srv.URL, WithCodec(codec), UseNumber(), WithSubscriptionProtocols(GraphQLSSE))
+
+	results, err := client.Subscribe(ctx, NewRequest("subscription { id }"))
+	is.NoErr(err)
+	result := <-results
+	is.NoErr(result.Err)
+	var data map[string]interface{}
+	is.NoErr(result.Decode(&data))
+	is.Equal(data["id"], json.Number("9007199254740993"))
+	for range results {
+	}
+	is.Equal(codec.marshals, 1)
+	is.Equal(codec.decoders, 2) // the result, then its data
+
+	patches, err := client.RunIncremental(ctx, NewRequest("query { id }"))
+	is.NoErr(err)
+	for range patches {
+	}
+	is.Equal(codec.marshals, 2)
+	is.Equal(codec.decoders, 3)
+}
@@ -0,0 +1,68 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// collector gathers the items added within window of each other into
+// batches, kept apart by key, and sends each batch once the window has
+// passed or as soon as it holds maxSize items.
+type collector struct {
+	window  time.Duration
+	maxSize int
+	// send is called on its own goroutine with the items of a batch.
+	send func(ctx context.Context, items []interface{})
+
+	mu      sync.Mutex
+	pending map[string]*collected
+}
+
+type collected struct {
+	items []interface{}
+}
+
+func newCollector(window time.Duration, maxSize int, send func(ctx context.Context, items []interface{})) *collector {
+	return &collector{
+		window:  window,
+		maxSize: maxSize,
+		send:    send,
+		pending: make(map[string]*collected),
+	}
+}
+
+// add adds item to the batch being collected under key, starting one if
+// there is none.
+func (c *collector) add(key string, item interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	batch, ok := c.pending[key]
+	if !ok {
+		batch = &collected{}
+		c.pending[key] = batch
+		time.AfterFunc(c.window, func() {
+			c.mu.Lock()
+			if c.pending[key] != batch {
+				// already sent because it was full
+				c.mu.Unlock()
+				return
+			}
+			delete(c.pending, key)
+			c.mu.Unlock()
+			c.send(sharedContext(), batch.items)
+		})
+	}
+	batch.items = append(batch.items, item)
+	if c.maxSize > 0 && len(batch.items) >= c.maxSize {
+		delete(c.pending, key)
+		go c.send(sharedContext(), batch.items)
+	}
+}
+
+// sharedContext is the context of a request made on behalf of several
+// callers. The request outlives the callers, so it must not be cancelled by
+// any one of them.
+func sharedContext() context.Context {
+	return context.Background()
+}
@@ -0,0 +1,123 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WithRequestCompression gzips JSON request bodies larger than threshold
+// bytes and marks them with a Content-Encoding header. The server must
+// accept gzip encoded requests.
+func WithRequestCompression(threshold int) ClientOption {
+	return func(client *clientImp) {
+		client.compressThreshold = threshold
+		client.compressRequests = true
+	}
+}
+
+// WithResponseDecompression asks the server for gzip or deflate encoded
+// responses and decodes them in the client. Go's http.Transport already does
+// this for gzip unless it is disabled, but custom transports passed with
+// WithHTTPClient often do not.
+func WithResponseDecompression() ClientOption {
+	return func(client *clientImp) {
+		client.decompressResponses = true
+	}
+}
+
+// compressBody gzips body if request compression is enabled and body is
+// larger than the threshold. It returns the body to send and its content
+// encoding, which is empty if the body was left untouched.
+func (c *clientImp) compressBody(body *bytes.Buffer) (*bytes.Buffer, string, error) {
+	if !c.compressRequests || body.Len() <= c.compressThreshold {
+		return body, "", nil
+	}
+	size := body.Len()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := body.WriteTo(zw); err != nil {
+		return nil, "", errors.Wrap(err, "compress body")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", errors.Wrap(err, "compress body")
+	}
+	c.logf(">> compressed body from %d to %d bytes", size, compressed.Len())
+	return &compressed, "gzip", nil
+}
+
+// send sends r through the http.Client, negotiating and decoding compressed
+// responses when response decompression is enabled.
+func (c *clientImp) send(r *http.Request) (*http.Response, error) {
+	if !c.decompressResponses {
+		return c.httpClient.Do(r)
+	}
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return resp, err
+	}
+	if err := decodeResponseBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// decodeResponseBody replaces the body of a gzip or deflate encoded
+// response with a decoding reader.
+func decodeResponseBody(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "x-gzip" && encoding != "deflate" {
+		return nil
+	}
+	br := bufio.NewReader(resp.Body)
+	if _, err := br.Peek(1); err == io.EOF {
+		// nothing to decode, e.g. 304 Not Modified
+		return nil
+	}
+	var decoded io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return errors.Wrap(err, "decode gzip response")
+		}
+		decoded = zr
+	case "deflate":
+		// RFC 7230 deflate is zlib wrapped, but some servers send raw deflate.
+		header, _ := br.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return errors.Wrap(err, "decode deflate response")
+			}
+			decoded = zr
+		} else {
+			decoded = flate.NewReader(br)
+		}
+	}
+	resp.Body = &decodedBody{Reader: decoded, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody reads decoded content and closes the original body.
+type decodedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	return d.body.Close()
+}
@@ -0,0 +1,85 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRequestCompression(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var body io.Reader = r.Body
+		if calls == 1 {
+			is.Equal(r.Header.Get("Content-Encoding"), "gzip")
+			zr, err := gzip.NewReader(r.Body)
+			is.NoErr(err)
+			body = zr
+		} else {
+			is.Equal(r.Header.Get("Content-Encoding"), "")
+		}
+		b, err := ioutil.ReadAll(body)
+		is.NoErr(err)
+		is.True(strings.HasPrefix(string(b), `{"query":"mutation {}"`))
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRequestCompression(100))
+
+	req := NewRequest("mutation {}")
+	req.Var("ids", strings.Repeat("id,", 100))
+	is.NoErr(client.Run(ctx, req, nil))
+
+	// below the threshold
+	is.NoErr(client.Run(ctx, NewRequest("mutation {}"), nil))
+	is.Equal(calls, 2)
+}
+
+func TestResponseDecompression(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("Accept-Encoding"), "gzip, deflate")
+		var buf bytes.Buffer
+		switch r.URL.Query().Get("encoding") {
+		case "gzip":
+			zw := gzip.NewWriter(&buf)
+			io.WriteString(zw, `{"data":{"value":"gzip data"}}`)
+			zw.Close()
+		case "deflate":
+			zw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+			io.WriteString(zw, `{"data":{"value":"deflate data"}}`)
+			zw.Close()
+		}
+		w.Header().Set("Content-Encoding", r.URL.Query().Get("encoding"))
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	httpClient := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		client := NewClient(srv.URL+"?encoding="+encoding, WithHTTPClient(httpClient), WithResponseDecompression())
+		var resp struct {
+			Value string
+		}
+		is.NoErr(client.Run(ctx, NewRequest("query {}"), &resp))
+		is.Equal(resp.Value, encoding+" data")
+	}
+}
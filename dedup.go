@@ -0,0 +1,69 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// WithDeduplication shares a single request between concurrent Run calls
+// for the same query: same document, variables and headers. The response is
+// decoded into the response object of every caller independently.
+// Mutations and requests with files are always sent.
+func WithDeduplication() ClientOption {
+	return func(client *clientImp) {
+		client.flights = &flightGroup{
+			calls: make(map[string]*flightCall),
+		}
+	}
+}
+
+// flightGroup tracks the requests in flight by request key.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is a request in flight and, once done is closed, its result.
+type flightCall struct {
+	data json.RawMessage
+	err  error
+	done chan struct{}
+}
+
+// runShared runs req, or waits for the identical request already in flight.
+func (c *clientImp) runShared(ctx context.Context, req *Request, resp interface{}) error {
+	key, err := c.requestKey(req)
+	if err != nil {
+		return err
+	}
+
+	c.flights.mu.Lock()
+	call, ok := c.flights.calls[key]
+	if !ok {
+		call = &flightCall{done: make(chan struct{})}
+		c.flights.calls[key] = call
+		go func() {
+			call.err = c.run(sharedContext(), req, &call.data)
+			c.flights.mu.Lock()
+			delete(c.flights.calls, key)
+			c.flights.mu.Unlock()
+			close(call.done)
+		}()
+	} else {
+		c.logf("(dedup) joining request in flight: %s", key)
+	}
+	c.flights.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.done:
+	}
+	if resp != nil && len(call.data) > 0 {
+		if err := c.decodeData(call.data, resp); err != nil && call.err == nil {
+			return err
+		}
+	}
+	return call.err
+}
@@ -0,0 +1,100 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestDeduplication(t *testing.T) {
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// keep the request in flight while the others join it
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithDeduplication())
+
+	run := func(q string) []string {
+		var wg sync.WaitGroup
+		values := make([]string, 5)
+		for i := range values {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				req := NewRequest(q)
+				req.Var("id", "1")
+				var resp struct {
+					Value string
+				}
+				is.NoErr(client.Run(ctx, req, &resp))
+				values[i] = resp.Value
+			}(i)
+		}
+		wg.Wait()
+		return values
+	}
+
+	values := run("query ($id: ID!) { item(id: $id) { value } }")
+	is.Equal(atomic.LoadInt32(&calls), int32(1))
+	for _, value := range values {
+		is.Equal(value, "some data")
+	}
+
+	run("mutation ($id: ID!) { update(id: $id) { value } }")
+	is.Equal(atomic.LoadInt32(&calls), int32(6)) // mutations are never shared
+}
+
+func TestDeduplicationUploads(t *testing.T) {
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		file, _, err := r.FormFile("0")
+		is.NoErr(err)
+		b, err := ioutil.ReadAll(file)
+		is.NoErr(err)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, `{"data":{"value":"`+string(b)+`"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec(), WithDeduplication())
+
+	var wg sync.WaitGroup
+	contents := []string{"AAA", "BBB"}
+	values := make([]string, len(contents))
+	for i := range contents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := NewRequest("query ($f: Upload!) { checksum(file: $f) }")
+			req.Var("f", Upload{Name: "f.txt", R: strings.NewReader(contents[i])})
+			var resp struct {
+				Value string
+			}
+			is.NoErr(client.Run(ctx, req, &resp))
+			values[i] = resp.Value
+		}(i)
+	}
+	wg.Wait()
+	is.Equal(atomic.LoadInt32(&calls), int32(2)) // requests with files are never shared
+	is.Equal(values, contents)
+}
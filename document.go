@@ -0,0 +1,132 @@
+package graphql
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenPunct tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenString
+)
+
+// token is a lexical token of a GraphQL document. Start and End are byte
+// offsets into the source so callers can rewrite the document in place.
+type token struct {
+	Kind  tokenKind
+	Value string
+	Start int
+	End   int
+}
+
+// lex splits a GraphQL document into tokens, dropping whitespace, commas and
+// comments. It is deliberately lenient: it only needs to be good enough to
+// find operation types, root fields and variable references.
+func lex(src string) []token {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case c == '"':
+			start := i
+			if strings.HasPrefix(src[i:], `"""`) {
+				i += 3
+				for i < len(src) && !strings.HasPrefix(src[i:], `"""`) {
+					if strings.HasPrefix(src[i:], `\"""`) {
+						i += 4
+						continue
+					}
+					i++
+				}
+				i += 3
+			} else {
+				i++
+				for i < len(src) && src[i] != '"' && src[i] != '\n' {
+					if src[i] == '\\' {
+						i++
+					}
+					i++
+				}
+				i++
+			}
+			if i > len(src) {
+				i = len(src)
+			}
+			tokens = append(tokens, token{Kind: tokenString, Value: src[start:i], Start: start, End: i})
+		case c == '.' && strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, token{Kind: tokenPunct, Value: "...", Start: i, End: i + 3})
+			i += 3
+		case isNameStart(c):
+			start := i
+			for i < len(src) && isNameContinue(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{Kind: tokenName, Value: src[start:i], Start: start, End: i})
+		case c == '-' || (c >= '0' && c <= '9'):
+			start := i
+			i++
+			for i < len(src) && (isNameContinue(src[i]) || src[i] == '.' || src[i] == '+' || src[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, token{Kind: tokenNumber, Value: src[start:i], Start: start, End: i})
+		default:
+			tokens = append(tokens, token{Kind: tokenPunct, Value: string(c), Start: i, End: i + 1})
+			i++
+		}
+	}
+	return tokens
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// operationType returns the type of the first operation in the document:
+// "query", "mutation" or "subscription". The query shorthand ({ ... }) is
+// reported as "query". An empty string is returned if no operation is found.
+func operationType(q string) string {
+	depth := 0
+	inFragment := false
+	for _, tok := range lex(q) {
+		if tok.Kind == tokenPunct {
+			switch tok.Value {
+			case "{":
+				if depth == 0 && !inFragment {
+					return "query"
+				}
+				depth++
+			case "}":
+				depth--
+				if depth == 0 {
+					inFragment = false
+				}
+			}
+			continue
+		}
+		if depth > 0 || tok.Kind != tokenName {
+			continue
+		}
+		switch tok.Value {
+		case "query", "mutation", "subscription":
+			if !inFragment {
+				return tok.Value
+			}
+		case "fragment":
+			inFragment = true
+		}
+	}
+	return ""
+}
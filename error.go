@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net/http"
 )
 
 const (
@@ -18,13 +19,19 @@ const (
 	errInternal           graphErrType = "internal_error"
 )
 
-type graphErr struct {
-	Message    string        `json:"message,omitempty"`
-	Name       graphErrType  `json:"name,omitempty"`
-	TimeThrown string        `json:"time_thrown,omitempty"`
-	Data       interface{}   `json:"data,omitempty"`
-	Path       []interface{} `json:"path,omitempty"`
-	Locations  []graphErrLoc `json:"locations,omitempty"`
+// GraphQLError is an error in the errors of a GraphQL response.
+type GraphQLError struct {
+	Message    string                 `json:"message,omitempty"`
+	Name       graphErrType           `json:"name,omitempty"`
+	TimeThrown string                 `json:"time_thrown,omitempty"`
+	Data       interface{}            `json:"data,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []graphErrLoc          `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	return "graphql: " + e.Message
 }
 
 type graphErrData struct {
@@ -41,7 +48,7 @@ type graphErrLoc struct {
 
 type graphErrType string
 
-func getAggrErr(errList []graphErr) error {
+func getAggrErr(errList []GraphQLError) error {
 	var buffer bytes.Buffer
 	buffer.WriteString("graphql: ")
 	for idx, err := range errList {
@@ -51,7 +58,7 @@ func getAggrErr(errList []graphErr) error {
 	return errors.New(buffer.String())
 }
 
-func shouldRetry(errList []graphErr) bool {
+func shouldRetry(errList []GraphQLError) bool {
 	for _, err := range errList {
 		if err.Name == errCapacityExceeded || err.Name == errServiceUnavailable || err.Name == errServiceFailure || err.Name == errInternal {
 			return true
@@ -60,3 +67,70 @@ func shouldRetry(errList []graphErr) bool {
 
 	return false
 }
+
+// BatchError is returned by RunBatch and RunMerged when one or more
+// operations of the batch failed. Errors holds one entry per request, in the same order,
+// which is nil for the operations that succeeded.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("graphql: batch: ")
+	for idx, err := range e.Errors {
+		if err != nil {
+			buffer.WriteString(fmt.Sprintf("operation %d: (%s). ", idx, err))
+		}
+	}
+	return buffer.String()
+}
+
+// HTTPError is returned when the server answers with a body that is not a
+// GraphQL response, such as the HTML error page of a load balancer, or with
+// an error status and neither data nor errors.
+type HTTPError struct {
+	StatusCode  int
+	ContentType string
+	Header      http.Header
+	// Body is the start of the body of the response, up to 4KB.
+	Body []byte
+	// Err is the error decoding the body, if it could not be decoded.
+	Err error
+}
+
+func newHTTPError(resp *http.Response, body []byte, err error) *HTTPError {
+	return &HTTPError{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Header:      resp.Header,
+		Body:        body,
+		Err:         err,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("graphql: Decode error: (%v), status %d, content type %q, body: %s", e.Err, e.StatusCode, e.ContentType, e.Body)
+	}
+	return fmt.Sprintf("graphql: unexpected status %d, content type %q, body: %s", e.StatusCode, e.ContentType, e.Body)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// retryError is returned once a request has been tried the maximum number
+// of times, wrapping the error of the last try.
+type retryError struct {
+	tries int
+	err   error
+}
+
+func (e *retryError) Error() string {
+	return fmt.Sprintf("Client has retried %d times but unable to get a successful response. Error: %+v", e.tries, e.err)
+}
+
+func (e *retryError) Unwrap() error {
+	return e.err
+}
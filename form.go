@@ -0,0 +1,314 @@
+package graphql
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// formBody is a multipart/form-data body that is streamed to the server,
+// reading its files as it goes instead of holding them in memory. It is
+// opened again for each attempt of a request.
+type formBody struct {
+	boundary string
+	fields   []formField
+	files    []*formFile
+	progress func(Progress)
+
+	// pipe and done belong to the last opening of the body.
+	pipe *io.PipeReader
+	done chan struct{}
+}
+
+type formField struct {
+	name  string
+	value string
+}
+
+// formFile is a file of a formBody.
+type formFile struct {
+	field string
+	file  File
+	// keep buffers the contents of a reader that can neither be opened
+	// again nor rewound, so the request can be retried.
+	keep bool
+
+	opened   int
+	seekable bool
+	start    int64
+	buf      *bytes.Buffer
+	// sum is the checksum of the file, once computed.
+	sum string
+	// size is the size of the file, or -1 if it is not known, once measured.
+	size     int64
+	measured bool
+}
+
+func newFormBody() *formBody {
+	return &formBody{
+		boundary: multipart.NewWriter(ioutil.Discard).Boundary(),
+	}
+}
+
+func (b *formBody) addField(name, value string) {
+	b.fields = append(b.fields, formField{name: name, value: value})
+}
+
+func (b *formBody) addFile(field string, file File, keep bool) {
+	// the checksum of a file is computed before sending it
+	keep = keep || file.Checksum != ""
+	b.files = append(b.files, &formFile{field: field, file: file, keep: keep})
+}
+
+// request makes the request sending the body to endpoint.
+func (b *formBody) request(endpoint string) (*http.Request, error) {
+	r, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.GetBody = func() (io.ReadCloser, error) {
+		return &lazyBody{open: b.open}, nil
+	}
+	r.Body, _ = r.GetBody()
+	return r, nil
+}
+
+// lazyBody opens a body when it is first read, so nothing is read from the
+// files of a request that is never sent, e.g. because it is served from the
+// cache.
+type lazyBody struct {
+	open func() (io.ReadCloser, error)
+	body io.ReadCloser
+}
+
+func (l *lazyBody) Read(p []byte) (int, error) {
+	if l.body == nil {
+		body, err := l.open()
+		if err != nil {
+			return 0, err
+		}
+		l.body = body
+	}
+	return l.body.Read(p)
+}
+
+func (l *lazyBody) Close() error {
+	if l.body == nil {
+		return nil
+	}
+	return l.body.Close()
+}
+
+func (b *formBody) contentType() string {
+	return "multipart/form-data; boundary=" + b.boundary
+}
+
+// open starts writing the body to the returned reader.
+func (b *formBody) open() (io.ReadCloser, error) {
+	if b.pipe != nil {
+		// the files must not be read by two attempts at once
+		b.pipe.Close()
+		<-b.done
+	}
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	b.pipe, b.done = pr, done
+	go func() {
+		defer close(done)
+		pw.CloseWithError(b.write(pw))
+	}()
+	return pr, nil
+}
+
+func (b *formBody) write(w io.Writer) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+	for _, field := range b.fields {
+		if err := writer.WriteField(field.name, field.value); err != nil {
+			return errors.Wrapf(err, "write %s field", field.name)
+		}
+	}
+	var reporter *progressReporter
+	if b.progress != nil {
+		for _, f := range b.files {
+			f.measure()
+		}
+		reporter = newProgressReporter(b.progress, b.files)
+	}
+	for _, f := range b.files {
+		if f.file.Checksum != "" && f.sum == "" {
+			if err := f.computeChecksum(); err != nil {
+				return errors.Wrapf(err, "checksum file %s", f.file.Name)
+			}
+		}
+		src, err := f.open()
+		if err != nil {
+			return errors.Wrapf(err, "open file %s", f.file.Name)
+		}
+		var r io.Reader = src
+		contentType := f.file.ContentType
+		if contentType == "" && f.file.DetectContentType {
+			contentType, r, err = detectContentType(f.file.Name, r)
+			if err != nil {
+				src.Close()
+				return errors.Wrapf(err, "read file %s", f.file.Name)
+			}
+		}
+		part, err := writer.CreatePart(f.header(contentType))
+		if err != nil {
+			src.Close()
+			return errors.Wrap(err, "create form file")
+		}
+		if reporter != nil {
+			r = reporter.reader(f, r)
+		}
+		_, err = io.Copy(part, r)
+		src.Close()
+		if err != nil {
+			return errors.Wrapf(err, "read file %s", f.file.Name)
+		}
+	}
+	return writer.Close()
+}
+
+// open returns the contents of the file for an attempt. Files with an Open
+// function are opened again, seekable readers are rewound, and other
+// readers are replayed from what the previous attempts read of them.
+func (f *formFile) open() (io.ReadCloser, error) {
+	opened := f.opened
+	f.opened++
+	switch {
+	case f.file.Open != nil:
+		return f.file.Open()
+	case opened == 0:
+		if seeker, ok := f.file.R.(io.Seeker); ok {
+			if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+				f.seekable, f.start = true, start
+				return ioutil.NopCloser(f.file.R), nil
+			}
+		}
+		if f.keep {
+			f.buf = new(bytes.Buffer)
+			return ioutil.NopCloser(io.TeeReader(f.file.R, f.buf)), nil
+		}
+		return ioutil.NopCloser(f.file.R), nil
+	case f.seekable:
+		if _, err := f.file.R.(io.Seeker).Seek(f.start, io.SeekStart); err != nil {
+			return nil, errors.Wrap(err, "rewind")
+		}
+		return ioutil.NopCloser(f.file.R), nil
+	case f.buf != nil:
+		// the previous attempt may have stopped before the end
+		read := bytes.NewReader(f.buf.Bytes())
+		return ioutil.NopCloser(io.MultiReader(read, io.TeeReader(f.file.R, f.buf))), nil
+	}
+	return nil, errors.New("cannot be read again")
+}
+
+// measure finds the size of the file before it is first read.
+func (f *formFile) measure() {
+	if f.measured {
+		return
+	}
+	f.measured = true
+	f.size = -1
+	if f.file.Size > 0 {
+		f.size = f.file.Size
+		return
+	}
+	if f.file.Open != nil {
+		return
+	}
+	if seeker, ok := f.file.R.(io.Seeker); ok {
+		current, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if _, errBack := seeker.Seek(current, io.SeekStart); err == nil && errBack == nil {
+			f.size = end - current
+		}
+		return
+	}
+	if lener, ok := f.file.R.(interface{ Len() int }); ok {
+		f.size = int64(lener.Len())
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// header returns the headers of the part of the file.
+func (f *formFile) header(contentType string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	for key, values := range f.file.Header {
+		h[textproto.CanonicalMIMEHeaderKey(key)] = append([]string(nil), values...)
+	}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(f.field), quoteEscaper.Replace(f.file.Name)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	switch f.file.Checksum {
+	case ChecksumMD5:
+		h.Set("Content-MD5", f.sum)
+		h.Set("Digest", "md5="+f.sum)
+	case ChecksumSHA256:
+		h.Set("Digest", "sha-256="+f.sum)
+	}
+	return h
+}
+
+// computeChecksum reads the file through once to compute its checksum.
+func (f *formFile) computeChecksum() error {
+	var h hash.Hash
+	switch f.file.Checksum {
+	case ChecksumMD5:
+		h = md5.New()
+	case ChecksumSHA256:
+		h = sha256.New()
+	default:
+		return errors.Errorf("unsupported checksum %q", f.file.Checksum)
+	}
+	src, err := f.open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := io.Copy(h, src); err != nil {
+		return err
+	}
+	f.sum = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// detectContentType finds the content type of a file from the extension of
+// its name or, failing that, from its first 512 bytes. It returns a reader
+// of the whole file.
+func detectContentType(name string, r io.Reader) (string, io.Reader, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType, r, nil
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
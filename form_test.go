@@ -0,0 +1,135 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// onlyReader hides the other methods of a reader, such as Seek.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestFileRetry(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.ContentLength, int64(-1)) // streamed
+		is.NoErr(r.ParseMultipartForm(1 << 20))
+		for _, field := range []string{"opened", "seeker", "reader"} {
+			file, _, err := r.FormFile(field)
+			is.NoErr(err)
+			b, err := ioutil.ReadAll(file)
+			is.NoErr(err)
+			is.Equal(string(b), "contents of "+field)
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{"ok":true}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTestDuration(1))
+	defer cancel()
+	retryConfig := RetryConfig{
+		MaxTries: 2,
+		Interval: 1,
+		Policy:   Linear,
+	}
+	client := NewClient(srv.URL, UseMultipartForm(), WithRetryConfig(retryConfig))
+
+	var opens int32
+	req := NewRequest("mutation { upload }")
+	req.FileFunc("opened", "opened.txt", func() (io.ReadCloser, error) {
+		atomic.AddInt32(&opens, 1)
+		return ioutil.NopCloser(strings.NewReader("contents of opened")), nil
+	})
+	req.File("seeker", "seeker.txt", strings.NewReader("contents of seeker"))
+	req.File("reader", "reader.txt", onlyReader{strings.NewReader("contents of reader")})
+	var resp struct {
+		OK bool
+	}
+	is.NoErr(client.Run(ctx, req, &resp))
+	is.True(resp.OK)
+	is.Equal(atomic.LoadInt32(&calls), int32(2))
+	is.Equal(atomic.LoadInt32(&opens), int32(2))
+}
+
+func TestFileNotRetryable(t *testing.T) {
+	is := is.New(t)
+	file := &formFile{file: File{Name: "reader.txt", R: onlyReader{strings.NewReader("contents")}}}
+	src, err := file.open()
+	is.NoErr(err)
+	b, err := ioutil.ReadAll(src)
+	is.NoErr(err)
+	is.Equal(string(b), "contents")
+	_, err = file.open()
+	is.True(err != nil) // neither kept nor rewindable
+}
+
+func TestFileParts(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.NoErr(r.ParseMultipartForm(1 << 20))
+		_, header, err := r.FormFile("video")
+		is.NoErr(err)
+		is.Equal(header.Header.Get("Content-Type"), "video/mp4")
+		is.Equal(header.Header.Get("X-Asset-Id"), "123")
+		// sha256 of "contents of video"
+		is.Equal(header.Header.Get("Digest"), "sha-256=NjIc0lba4AVvgqybvMBvFkxtVRY1hQ97sltB1ht/ogY=")
+
+		_, header, err = r.FormFile("notes")
+		is.NoErr(err)
+		is.Equal(header.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+		// md5 of "contents of notes"
+		is.Equal(header.Header.Get("Content-MD5"), "y9ao9uWwvTWW6LEGcYY+ow==")
+
+		_, header, err = r.FormFile("page")
+		is.NoErr(err)
+		is.Equal(header.Header.Get("Content-Type"), "text/html; charset=utf-8")
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartForm())
+
+	req := NewRequest("mutation { upload }")
+	req.files = []File{
+		{
+			Field:       "video",
+			Name:        "video",
+			R:           strings.NewReader("contents of video"),
+			ContentType: "video/mp4",
+			Header:      http.Header{"X-Asset-Id": {"123"}},
+			Checksum:    ChecksumSHA256,
+		},
+		{
+			Field:             "notes",
+			Name:              "notes.txt",
+			R:                 onlyReader{strings.NewReader("contents of notes")},
+			DetectContentType: true,
+			Checksum:          ChecksumMD5,
+		},
+		{
+			Field:             "page",
+			Name:              "page",
+			R:                 strings.NewReader("<html><body>contents of page</body></html>"),
+			DetectContentType: true,
+		},
+	}
+	is.NoErr(client.Run(ctx, req, nil))
+}
@@ -0,0 +1,48 @@
+//go:build go1.18
+// +build go1.18
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Do runs req with client and returns its data decoded into a T.
+//
+//	type Items struct {
+//	    Items []Item
+//	}
+//	data, err := graphql.Do[Items](ctx, client, req)
+func Do[T any](ctx context.Context, client Client, req *Request) (T, error) {
+	var data T
+	err := client.Run(ctx, req, &data)
+	return data, err
+}
+
+// DoResponse runs req with client and returns its data decoded into a T,
+// along with the whole response holding its errors and extensions.
+func DoResponse[T any](ctx context.Context, client Client, req *Request) (T, *Response, error) {
+	var data T
+	resp := &Response{Data: &data}
+	err := client.Run(ctx, req, resp)
+	return data, resp, err
+}
+
+// DoAt runs req with client and returns the value at path in its data
+// decoded into a T. Path elements are field names, or indexes in lists.
+//
+//	items, err := graphql.DoAt[[]Item](ctx, client, req, "items")
+func DoAt[T any](ctx context.Context, client Client, req *Request, path ...string) (T, error) {
+	var value T
+	var data json.RawMessage
+	if err := client.Run(ctx, req, &data); err != nil {
+		return value, err
+	}
+	raw, err := lookupPath(data, path)
+	if err != nil {
+		return value, err
+	}
+	err = decodeClientData(client, raw, &value)
+	return value, err
+}
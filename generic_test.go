@@ -0,0 +1,89 @@
+//go:build go1.18
+// +build go1.18
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+type testItem struct {
+	ID   string
+	Name string
+}
+
+func newItemsServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+}
+
+func TestDo(t *testing.T) {
+	is := is.New(t)
+	srv := newItemsServer(`{"data":{"items":[{"id":"1","name":"first"},{"id":"2","name":"second"}]}}`)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	data, err := Do[struct{ Items []testItem }](ctx, client, NewRequest("query { items { id name } }"))
+	is.NoErr(err)
+	is.Equal(len(data.Items), 2)
+	is.Equal(data.Items[1].Name, "second")
+
+	items, err := DoAt[[]testItem](ctx, client, NewRequest("query { items { id name } }"), "items")
+	is.NoErr(err)
+	is.Equal(items[0].ID, "1")
+
+	name, err := DoAt[string](ctx, client, NewRequest("query { items { id name } }"), "items", "1", "name")
+	is.NoErr(err)
+	is.Equal(name, "second")
+
+	_, err = DoAt[string](ctx, client, NewRequest("query { items { id name } }"), "items", "5")
+	is.True(err != nil)
+}
+
+func TestDoResponse(t *testing.T) {
+	is := is.New(t)
+	srv := newItemsServer(`{
+		"data":{"items":[{"id":"1","name":"first"}]},
+		"errors":[{"message":"second item unavailable","path":["items",1],"extensions":{"code":"UNAVAILABLE"}}],
+		"extensions":{"cost":3}
+	}`)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	data, resp, err := DoResponse[struct{ Items []testItem }](ctx, client, NewRequest("query { items { id name } }"))
+	is.True(err != nil)
+	is.Equal(len(data.Items), 1) // partial data
+	is.Equal(len(resp.Errors), 1)
+	is.Equal(resp.Errors[0].Message, "second item unavailable")
+	is.Equal(resp.Errors[0].Extensions["code"], "UNAVAILABLE")
+	is.Equal(resp.Extensions["cost"], float64(3))
+}
+
+func TestDoAtUseNumber(t *testing.T) {
+	is := is.New(t)
+	srv := newItemsServer(`{"data":{"item":{"id":9007199254740993}}}`)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseNumber())
+
+	item, err := DoAt[map[string]interface{}](ctx, client, NewRequest("query { item { id } }"), "item")
+	is.NoErr(err)
+	is.Equal(item["id"], json.Number("9007199254740993"))
+}
@@ -39,10 +39,10 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
-	"mime/multipart"
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -50,6 +50,9 @@ import (
 
 type Client interface {
 	Run(ctx context.Context, req *Request, resp interface{}) error
+	RunBatch(ctx context.Context, reqs []*Request, resps []interface{}) error
+	Subscribe(ctx context.Context, req *Request) (<-chan Result, error)
+	RunIncremental(ctx context.Context, req *Request) (<-chan Patch, error)
 	SetLogger(func(string))
 }
 
@@ -58,9 +61,39 @@ type clientImp struct {
 	endpoint         string
 	httpClient       *http.Client
 	useMultipartForm bool
+	// useMultipartSpec sends files following the GraphQL multipart request spec
+	useMultipartSpec bool
 	retryConfig      RetryConfig
 	defaultHeaders   map[string]string
+	// codec encodes requests and decodes responses, applying useNumber and
+	// disallowUnknownFields to the response data
+	codec                 Codec
+	useNumber             bool
+	disallowUnknownFields bool
+	// maxResponseSize and maxResponseDepth limit the responses decoded
+	maxResponseSize  int64
+	maxResponseDepth int
 	log              func(s string)
+	cache            CacheStore
+	// compressRequests gzips JSON bodies larger than compressThreshold bytes
+	compressRequests    bool
+	compressThreshold   int
+	decompressResponses bool
+	// retryFailedBatchOps re-sends only the failed operations of a batch
+	retryFailedBatchOps bool
+	batcher             *autoBatcher
+	flights             *flightGroup
+	// subscriptionEndpoint overrides the WebSocket endpoint for subscriptions
+	subscriptionEndpoint  string
+	subscriptionProtocols []SubscriptionProtocol
+	subscriptionKeepAlive time.Duration
+	// subscriptionIdleTimeout is how long a WebSocket without subscriptions
+	// is kept open
+	subscriptionIdleTimeout time.Duration
+	subscriptionBufferSize  int
+	// wsConns are the open WebSockets, keyed by request headers
+	wsMu    sync.Mutex
+	wsConns map[string]*wsConn
 	// closeReq will close the request body immediately allowing for reuse of client
 	closeReq bool
 }
@@ -68,8 +101,10 @@ type clientImp struct {
 // NewClient makes a new Client capable of making GraphQL requests.
 func NewClient(endpoint string, opts ...ClientOption) Client {
 	c := &clientImp{
-		endpoint: endpoint,
-		log:      func(string) {},
+		endpoint:                endpoint,
+		log:                     func(string) {},
+		codec:                   jsonCodec{},
+		subscriptionIdleTimeout: defaultSubscriptionIdleTimeout,
 	}
 	for _, optionFunc := range opts {
 		optionFunc(c)
@@ -80,6 +115,12 @@ func NewClient(endpoint string, opts ...ClientOption) Client {
 	if c.retryConfig.Policy == "" {
 		c.retryConfig = defaultNoRetryConfig
 	}
+	if len(c.subscriptionProtocols) == 0 {
+		c.subscriptionProtocols = defaultSubscriptionProtocols
+	}
+	if c.subscriptionBufferSize <= 0 {
+		c.subscriptionBufferSize = defaultSubscriptionBufferSize
+	}
 	return c
 }
 
@@ -138,13 +179,17 @@ var (
 )
 
 // Wrapper method to send request while optionally applying retry policy
-func (c *clientImp) sendRequest(retryConfig RetryConfig, gr *graphResponse, req *http.Request, tryCount int) (bool, *http.Response, error) {
-	gr.Errors = nil
+func (c *clientImp) sendRequest(retryConfig RetryConfig, gr responseBody, req *http.Request, tryCount int) (bool, *http.Response, error) {
+	gr.reset()
 	shouldRetryRequest := false
 
 	c.logf("(sendRequest) debug request: %+v", req)
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	c.logf("(sendRequest) debug response: %+v", resp)
+	if response, ok := gr.(*Response); ok && resp != nil {
+		response.StatusCode = resp.StatusCode
+		response.Header = resp.Header
+	}
 
 	if err != nil {
 		c.logf("(sendRequest) debug http request error: %+v", err)
@@ -163,19 +208,20 @@ func (c *clientImp) sendRequest(retryConfig RetryConfig, gr *graphResponse, req
 
 	// Check retry by error messages in graphql response
 	if resp != nil {
-		errDecode := getGraphQLResp(resp.Body, &gr)
+		errDecode := c.getGraphQLResp(resp, gr)
+		if limitErr, ok := errDecode.(*ResponseLimitError); ok {
+			return false, resp, limitErr
+		}
 		if errDecode != nil {
 			if err != nil {
-				errDecode = fmt.Errorf("Origin error: (%+v), Decode error: (%+v), Response: (%s)", err, errDecode, toJSONString(resp))
-			} else {
-				errDecode = fmt.Errorf("Decode error: (%+v), Response: (%s)", errDecode, toJSONString(resp))
+				errDecode = errors.Wrapf(errDecode, "Origin error: (%+v)", err)
 			}
 
 			return shouldRetryRequest, resp, errDecode
 		}
-		if len(gr.Errors) > 0 {
-			err = getAggrErr(gr.Errors)
-			shouldRetryRequest = shouldRetry(gr.Errors)
+		if errGraph := gr.err(); errGraph != nil {
+			err = errGraph
+			shouldRetryRequest = gr.retryable()
 		}
 	}
 
@@ -260,12 +306,30 @@ func (c *clientImp) Run(ctx context.Context, req *Request, resp interface{}) err
 		return ctx.Err()
 	default:
 	}
-	if len(req.files) > 0 && !c.useMultipartForm {
-		return errors.New("cannot send files with PostFields option")
+	_, whole := resp.(*Response)
+	if c.flights != nil && !whole && len(req.files) == 0 && !hasUploadVars(req) && operationType(req.q) == "query" {
+		return c.runShared(ctx, req, resp)
+	}
+	return c.run(ctx, req, resp)
+}
+
+// run sends req as JSON, or as multipart form data if it has files or the
+// client always uses it.
+func (c *clientImp) run(ctx context.Context, req *Request, resp interface{}) error {
+	if c.useMultipartSpec {
+		if uploads := requestUploads(req); len(uploads) > 0 {
+			return c.runWithUploads(ctx, req, uploads, resp)
+		}
+	} else if hasUploadVars(req) {
+		// they would be sent as null
+		return errors.New("graphql: Upload variables need a client created with UseMultipartRequestSpec")
 	}
-	if c.useMultipartForm {
+	if c.useMultipartForm || len(req.files) > 0 {
 		return c.runWithPostFields(ctx, req, resp)
 	}
+	if _, whole := resp.(*Response); c.batcher != nil && !whole {
+		return c.batcher.run(ctx, req, resp)
+	}
 	return c.runWithJSON(ctx, req, resp)
 }
 
@@ -308,7 +372,6 @@ func (c *clientImp) getTracer() *httptrace.ClientTrace {
 }
 
 func (c *clientImp) runWithJSON(ctx context.Context, req *Request, resp interface{}) error {
-	var requestBody bytes.Buffer
 	requestBodyObj := struct {
 		Query     string                 `json:"query"`
 		Variables map[string]interface{} `json:"variables"`
@@ -316,27 +379,47 @@ func (c *clientImp) runWithJSON(ctx context.Context, req *Request, resp interfac
 		Query:     req.q,
 		Variables: req.vars,
 	}
-	if err := json.NewEncoder(&requestBody).Encode(requestBodyObj); err != nil {
+	b, err := c.codec.Marshal(requestBodyObj)
+	if err != nil {
 		return errors.Wrap(err, "encode body")
 	}
+	// ended by a newline, as json.Encoder does
+	requestBody := bytes.NewBuffer(append(b, '\n'))
 	c.logf(">> variables: %v", req.vars)
 	c.logf(">> query: %s", req.q)
-	gr := &graphResponse{
-		Data: resp,
+	gr := newResponseBody(resp)
+
+	body, contentEncoding, err := c.compressBody(requestBody)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, c.endpoint, body)
+	if err != nil {
+		return err
 	}
 
-	r, err := http.NewRequest(http.MethodPost, c.endpoint, &requestBody)
+	if contentEncoding != "" {
+		r.Header.Set("Content-Encoding", contentEncoding)
+	}
+	r = c.prepareRequest(r, "application/json; charset=utf-8", req.Header)
+
+	r, err = c.withCacheKey(r, req)
 	if err != nil {
 		return err
 	}
+	return c.executeRequest(gr, r)
+}
 
+// prepareRequest sets the content type, default headers and request headers
+// on r and attaches the connection tracer.
+func (c *clientImp) prepareRequest(r *http.Request, contentType string, header http.Header) *http.Request {
 	r.Close = c.closeReq
-	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Header.Set("Content-Type", contentType)
 	r.Header.Set("Accept", "application/json; charset=utf-8")
 	for key, value := range c.defaultHeaders {
 		r.Header.Add(key, value)
 	}
-	for key, values := range req.Header {
+	for key, values := range header {
 		for _, value := range values {
 			r.Header.Add(key, value)
 		}
@@ -345,36 +428,100 @@ func (c *clientImp) runWithJSON(ctx context.Context, req *Request, resp interfac
 
 	// Get trace
 	trace := c.getTracer()
-	r = r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
-
-	return c.executeRequest(gr, r)
-}
-
-func getGraphQLResp(reader io.ReadCloser, schema interface{}) error {
-	defer reader.Close()
-
-	err := json.NewDecoder(reader).Decode(schema)
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+}
+
+// getGraphQLResp decodes the body of resp into gr. Bodies that are not
+// GraphQL responses fail with an *HTTPError.
+func (c *clientImp) getGraphQLResp(resp *http.Response, gr responseBody) error {
+	defer resp.Body.Close()
+
+	reader := c.limitBody(resp.Body)
+	var err, errData error
+	// result is unset for responses without data or errors
+	result := true
+	switch body := gr.(type) {
+	case *graphResponse:
+		// the data is decoded apart from the rest, with the decoding options
+		var envelope struct {
+			Data   json.RawMessage `json:"data"`
+			Errors []GraphQLError  `json:"errors"`
+		}
+		if err = c.codec.NewDecoder(reader).Decode(&envelope); err == nil {
+			body.Errors = envelope.Errors
+			result = hasData(envelope.Data) || len(envelope.Errors) > 0
+			errData = c.decodeData(envelope.Data, body.Data)
+		}
+	case *Response:
+		var b []byte
+		if b, err = ioutil.ReadAll(reader); err == nil {
+			errData = body.decode(b, c.unmarshal, c.decodeData)
+			if body.RawBody == nil {
+				// the body itself could not be decoded
+				err, errData = errData, nil
+			}
+			result = hasData(body.RawData) || len(body.Errors) > 0
+		}
+	case *batchResponse:
+		var b []byte
+		if b, err = ioutil.ReadAll(reader); err == nil {
+			err = body.decode(b)
+		}
+	default:
+		err = c.codec.NewDecoder(reader).Decode(gr)
+	}
+	if reader.err != nil {
+		return reader.err
+	}
 	if err != nil {
-		fmt.Println(fmt.Sprintf("Failed to decoding: %+v", errors.Wrap(err, "decoding response")))
-		return fmt.Errorf("Failed to decoding: %+v", err)
+		return newHTTPError(resp, reader.snippet(), err)
+	}
+	if errData != nil {
+		return errors.Wrap(errData, "Decode error: decoding data")
+	}
+	if !result && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return newHTTPError(resp, reader.snippet(), nil)
 	}
 
 	return nil
 }
 
-func (c *clientImp) executeRequest(gr *graphResponse, r *http.Request) error {
+// hasData reports whether the data of a response is set.
+func hasData(data json.RawMessage) bool {
+	return len(data) > 0 && string(data) != "null"
+}
+
+func (c *clientImp) executeRequest(gr responseBody, r *http.Request) error {
 	gqlRetryConfig := c.retryConfig
 	var body io.Reader = r.Body
+	// bodies that can be opened again are not kept in memory for retries
+	getBody := r.GetBody
 	var err error
 	var resp *http.Response
 	tryCount := 0
 	shouldRetryRequest := false
+	attempts := 0
+	if response, ok := gr.(*Response); ok {
+		start := time.Now()
+		defer func() {
+			response.Duration = time.Since(start)
+			response.Attempts = attempts
+		}()
+	}
 
 	for ; tryCount < gqlRetryConfig.MaxTries; tryCount++ {
 		buf := new(bytes.Buffer)
-		r.Body = ioutil.NopCloser(io.TeeReader(body, buf))
+		switch {
+		case getBody == nil:
+			r.Body = ioutil.NopCloser(io.TeeReader(body, buf))
+		case tryCount > 0:
+			if r.Body, err = getBody(); err != nil {
+				return errors.Wrap(err, "reopen body")
+			}
+		}
 		c.logf("<< [%d] %s", tryCount, buf.String())
 
+		attempts++
 		shouldRetryRequest, resp, err = c.sendRequest(gqlRetryConfig, gr, r, (tryCount + 1))
 		c.logf("<< [%d] gr: %+v", tryCount, gr)
 
@@ -392,6 +539,15 @@ func (c *clientImp) executeRequest(gr *graphResponse, r *http.Request) error {
 		}
 
 		body = buf
+		if partial, ok := gr.(retryPreparer); ok {
+			narrowed, errRetry := partial.prepareRetry(r)
+			if errRetry != nil {
+				return errRetry
+			}
+			if narrowed {
+				getBody = r.GetBody
+			}
+		}
 		timer := time.NewTimer(time.Duration(gqlRetryConfig.Interval) * time.Second)
 		ctx := r.Context()
 
@@ -407,66 +563,48 @@ func (c *clientImp) executeRequest(gr *graphResponse, r *http.Request) error {
 
 	}
 
-	return fmt.Errorf("Client has retried %d times but unable to get a successful response. Error: %+v", gqlRetryConfig.MaxTries, err)
+	return &retryError{tries: gqlRetryConfig.MaxTries, err: err}
 }
 
 func (c *clientImp) runWithPostFields(ctx context.Context, req *Request, resp interface{}) error {
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	if err := writer.WriteField("query", req.q); err != nil {
-		return errors.Wrap(err, "write query field")
-	}
-	var variablesBuf bytes.Buffer
+	body := newFormBody()
+	body.addField("query", req.q)
+	var variables []byte
 	if len(req.vars) > 0 {
-		variablesField, err := writer.CreateFormField("variables")
-		if err != nil {
-			return errors.Wrap(err, "create variables field")
-		}
-		if err := json.NewEncoder(io.MultiWriter(variablesField, &variablesBuf)).Encode(req.vars); err != nil {
+		var err error
+		if variables, err = c.codec.Marshal(req.vars); err != nil {
 			return errors.Wrap(err, "encode variables")
 		}
+		// ended by a newline, as json.Encoder does
+		variables = append(variables, '\n')
+		body.addField("variables", string(variables))
 	}
 	for i := range req.files {
-		part, err := writer.CreateFormFile(req.files[i].Field, req.files[i].Name)
-		if err != nil {
-			return errors.Wrap(err, "create form file")
-		}
-		if _, err := io.Copy(part, req.files[i].R); err != nil {
-			return errors.Wrap(err, "preparing file")
-		}
-	}
-	if err := writer.Close(); err != nil {
-		return errors.Wrap(err, "close writer")
+		body.addFile(req.files[i].Field, req.files[i], c.canRetry())
 	}
-	c.logf(">> variables: %s", variablesBuf.String())
+	body.progress = req.progress
+	c.logf(">> variables: %s", variables)
 	c.logf(">> files: %d", len(req.files))
 	c.logf(">> query: %s", req.q)
-	gr := &graphResponse{
-		Data: resp,
-	}
-	r, err := http.NewRequest(http.MethodPost, c.endpoint, &requestBody)
+	gr := newResponseBody(resp)
+	r, err := body.request(c.endpoint)
 	if err != nil {
 		return err
 	}
-	r.Close = c.closeReq
-	r.Header.Set("Content-Type", writer.FormDataContentType())
-	r.Header.Set("Accept", "application/json; charset=utf-8")
-	for key, value := range c.defaultHeaders {
-		r.Header.Add(key, value)
-	}
-	for key, values := range req.Header {
-		for _, value := range values {
-			r.Header.Add(key, value)
-		}
-	}
-	c.logf(">> headers: %v", r.Header)
+	r = c.prepareRequest(r, body.contentType(), req.Header)
 
-	// Get trace
-	trace := c.getTracer()
-	r = r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+	r, err = c.withCacheKey(r, req)
+	if err != nil {
+		return err
+	}
 	return c.executeRequest(gr, r)
 }
 
+// canRetry reports whether requests may be sent more than once.
+func (c *clientImp) canRetry() bool {
+	return c.retryConfig.Policy != "" && c.retryConfig.MaxTries > 1
+}
+
 // WithHTTPClient specifies the underlying http.Client to use when
 // making requests.
 //  NewClient(endpoint, WithHTTPClient(specificHTTPClient))
@@ -476,8 +614,9 @@ func WithHTTPClient(httpclient *http.Client) ClientOption {
 	}
 }
 
-// UseMultipartForm uses multipart/form-data and activates support for
-// files.
+// UseMultipartForm uses multipart/form-data for every request, including
+// those without files. Without it, only requests with files are sent as
+// multipart/form-data.
 func UseMultipartForm() ClientOption {
 	return func(client *clientImp) {
 		client.useMultipartForm = true
@@ -495,9 +634,42 @@ func ImmediatelyCloseReqBody() ClientOption {
 // modify the behaviour of the Client.
 type ClientOption func(*clientImp)
 
+// responseBody is decoded from the body of a GraphQL HTTP response.
+type responseBody interface {
+	// reset clears the errors decoded by a previous attempt.
+	reset()
+	// err returns the GraphQL errors of the response, if any.
+	err() error
+	// retryable reports whether the GraphQL errors are worth retrying.
+	retryable() bool
+}
+
+// retryPreparer is implemented by response bodies that only re-send part of
+// the original request when retrying. prepareRetry sets the GetBody of r to
+// the body of the next attempt and reports whether it did, or leaves r to
+// re-send the original body.
+type retryPreparer interface {
+	prepareRetry(r *http.Request) (bool, error)
+}
+
 type graphResponse struct {
 	Data   interface{}
-	Errors []graphErr
+	Errors []GraphQLError
+}
+
+func (gr *graphResponse) reset() {
+	gr.Errors = nil
+}
+
+func (gr *graphResponse) err() error {
+	if len(gr.Errors) == 0 {
+		return nil
+	}
+	return getAggrErr(gr.Errors)
+}
+
+func (gr *graphResponse) retryable() bool {
+	return shouldRetry(gr.Errors)
 }
 
 // Request is a GraphQL request.
@@ -505,6 +677,8 @@ type Request struct {
 	q     string
 	vars  map[string]interface{}
 	files []File
+	// progress is called as files are uploaded
+	progress func(Progress)
 
 	// Header represent any request headers that will be set
 	// when the request is made.
@@ -544,8 +718,9 @@ func (req *Request) Query() string {
 }
 
 // File sets a file to upload.
-// Files are only supported with a Client that was created with
-// the UseMultipartForm option.
+// Requests with files are sent as multipart/form-data.
+// Files are streamed to the server. To retry the request, r is rewound if
+// it is an io.Seeker, and kept in memory as it is read otherwise.
 func (req *Request) File(fieldname, filename string, r io.Reader) {
 	req.files = append(req.files, File{
 		Field: fieldname,
@@ -554,17 +729,47 @@ func (req *Request) File(fieldname, filename string, r io.Reader) {
 	})
 }
 
+// FileFunc sets a file to upload that is opened with open each time the
+// request is sent, so retries need not keep it in memory.
+func (req *Request) FileFunc(fieldname, filename string, open func() (io.ReadCloser, error)) {
+	req.files = append(req.files, File{
+		Field: fieldname,
+		Name:  filename,
+		Open:  open,
+	})
+}
+
 // File represents a file to upload.
 type File struct {
 	Field string
 	Name  string
 	R     io.Reader
+	// Open opens the contents of the file each time the request is sent,
+	// instead of reading R.
+	Open func() (io.ReadCloser, error)
+	// Size is the size of the file, if known, used to report progress.
+	// It is found from R when R is an io.Seeker.
+	Size int64
+	// ContentType is the content type of the file. If it is empty, the
+	// file is sent as application/octet-stream, unless DetectContentType is
+	// set to detect it from the extension of Name or the first 512 bytes of
+	// the file.
+	ContentType       string
+	DetectContentType bool
+	// Header holds extra headers of the part of the file.
+	Header http.Header
+	// Checksum sets a checksum of the file to send in the Digest header of
+	// its part, and for MD5 in the Content-MD5 header too. The file is read
+	// once to compute it before it is sent, and kept in memory if it can be
+	// neither reopened nor rewound.
+	Checksum Checksum
 }
 
-func toJSONString(data interface{}) string {
-	b, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Sprintf("%+v", data)
-	}
-	return string(b)
-}
+// Checksum is an algorithm for the checksum of a File.
+type Checksum string
+
+// Checksum algorithms.
+const (
+	ChecksumMD5    Checksum = "md5"
+	ChecksumSHA256 Checksum = "sha-256"
+)
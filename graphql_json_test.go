@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/matryer/is"
+	"github.com/pkg/errors"
 )
 
 func TestDoJSON(t *testing.T) {
@@ -67,6 +68,52 @@ func TestDoJSONServerError(t *testing.T) {
 	is.True(strings.Contains(err.Error(), "Decode error") && strings.Contains(err.Error(), "Internal Server Error"))
 }
 
+func TestDoJSONHTTPError(t *testing.T) {
+	is := is.New(t)
+	page := "<html><body>" + strings.Repeat("Bad Gateway ", 1000) + "</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("body") == "empty" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, page)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var responseData map[string]interface{}
+
+	err := NewClient(srv.URL).Run(ctx, NewRequest("query {}"), &responseData)
+	httpErr, ok := errors.Cause(err).(*HTTPError)
+	is.True(ok)
+	is.Equal(httpErr.StatusCode, http.StatusBadGateway)
+	is.Equal(httpErr.ContentType, "text/html")
+	is.Equal(httpErr.Header.Get("Content-Type"), "text/html")
+	is.Equal(string(httpErr.Body), page[:bodySnippetSize])
+	is.True(httpErr.Err != nil)
+
+	// a retried request still tells why it failed
+	retryConfig := RetryConfig{
+		MaxTries: 2,
+		Interval: 0,
+		Policy:   Linear,
+	}
+	client := NewClient(srv.URL+"?body=empty", WithRetryConfig(retryConfig))
+	err = client.Run(ctx, NewRequest("query {}"), &responseData)
+	is.True(strings.HasPrefix(err.Error(), "Client has retried 2 times"))
+	retryErr, ok := err.(*retryError)
+	is.True(ok)
+	httpErr, ok = errors.Cause(retryErr.err).(*HTTPError)
+	is.True(ok)
+	is.Equal(httpErr.StatusCode, http.StatusServiceUnavailable)
+	is.Equal(string(httpErr.Body), `{}`)
+	is.Equal(httpErr.Err, nil)
+}
+
 func TestDoJSONBadRequestErr(t *testing.T) {
 	is := is.New(t)
 	var calls int
@@ -257,6 +257,37 @@ func TestFile(t *testing.T) {
 	is.NoErr(err)
 }
 
+func TestFileWithJSONClient(t *testing.T) {
+	is := is.New(t)
+
+	var contentTypes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType := strings.Split(r.Header.Get("Content-Type"), ";")[0]
+		contentTypes = append(contentTypes, mediaType)
+		if mediaType == "multipart/form-data" {
+			is.Equal(r.FormValue("query"), "mutation {}")
+			file, _, err := r.FormFile("file")
+			is.NoErr(err)
+			defer file.Close()
+			b, err := ioutil.ReadAll(file)
+			is.NoErr(err)
+			is.Equal(string(b), `This is a file`)
+		}
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	req := NewRequest("mutation {}")
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	is.NoErr(client.Run(ctx, req, nil))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.Equal(contentTypes, []string{"multipart/form-data", "application/json"})
+}
+
 type roundTripperFunc func(req *http.Request) (*http.Response, error)
 
 func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -0,0 +1,310 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Patch is a payload of an incremental delivery response: the initial
+// result of a query using @defer or @stream, or a part delivered later.
+type Patch struct {
+	// Data is the initial data, or the data of a deferred fragment to be
+	// merged at Path.
+	Data json.RawMessage
+	// Items are the items of a streamed list to be appended to the list at
+	// Path.
+	Items []json.RawMessage
+	// Path is the path of the patched value in the data, made of field
+	// names and list indexes. It is empty for the initial result.
+	Path []interface{}
+	// Label is the label of the @defer or @stream directive.
+	Label string
+	// HasNext reports whether more patches follow.
+	HasNext bool
+	// Err holds the GraphQL errors of the patch, or the error that ended
+	// the response.
+	Err error
+}
+
+// incrementalPayload is a part of an incremental delivery response. Both
+// the current format, with patches in incremental, and the earlier one,
+// with a single patch in the payload itself, are decoded.
+type incrementalPayload struct {
+	incrementalPatch
+	HasNext     bool               `json:"hasNext"`
+	Incremental []incrementalPatch `json:"incremental"`
+}
+
+type incrementalPatch struct {
+	Data   json.RawMessage   `json:"data"`
+	Items  []json.RawMessage `json:"items"`
+	Path   []interface{}     `json:"path"`
+	Label  string            `json:"label"`
+	Errors []GraphQLError    `json:"errors"`
+}
+
+func (p incrementalPatch) empty() bool {
+	return len(p.Data) == 0 && p.Items == nil && len(p.Errors) == 0
+}
+
+func (p incrementalPatch) patch(hasNext bool) Patch {
+	patch := Patch{
+		Items:   p.Items,
+		Path:    p.Path,
+		Label:   p.Label,
+		HasNext: hasNext,
+	}
+	if string(p.Data) != "null" {
+		patch.Data = p.Data
+	}
+	if len(p.Errors) > 0 {
+		patch.Err = getAggrErr(p.Errors)
+	}
+	return patch
+}
+
+// RunIncremental executes a query that may use @defer or @stream and
+// delivers the initial result and each later patch on the returned
+// channel, which is closed once the response is complete, after an error,
+// or once ctx is done. Servers that answer with a single JSON result
+// deliver a single patch. Use MergePatch to assemble the patches into the
+// complete data.
+func (c *clientImp) RunIncremental(ctx context.Context, req *Request) (<-chan Patch, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if len(req.files) > 0 || hasUploadVars(req) {
+		return nil, errors.New("cannot send files with an incremental query")
+	}
+	payload, err := c.codec.Marshal(batchOperation{Query: req.q, Variables: req.vars})
+	if err != nil {
+		return nil, errors.Wrap(err, "encode body")
+	}
+	c.logf(">> variables: %v", req.vars)
+	c.logf(">> query: %s", req.q)
+	r, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	r = c.prepareRequest(r.WithContext(ctx), "application/json; charset=utf-8", req.Header)
+	r.Header.Set("Accept", "multipart/mixed; deferSpec=20220824, application/json")
+	resp, err := c.send(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "send request")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, newHTTPError(resp, c.limitBody(resp.Body).snippet(), nil)
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "application/json"
+	}
+	patches := make(chan Patch)
+	deliver := func(patch Patch) bool {
+		select {
+		case patches <- patch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(patches)
+		defer resp.Body.Close()
+		if !strings.HasPrefix(mediaType, "multipart/") {
+			var payload incrementalPayload
+			reader := c.limitBody(resp.Body)
+			if err := c.codec.NewDecoder(reader).Decode(&payload); err != nil {
+				if reader.err != nil {
+					err = reader.err
+				} else {
+					err = errors.Wrap(err, "decoding response")
+				}
+				deliver(Patch{Err: err})
+				return
+			}
+			deliver(payload.patch(false))
+			return
+		}
+		parts := multipart.NewReader(resp.Body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					deliver(Patch{Err: errors.Wrap(err, "reading response")})
+				}
+				return
+			}
+			// the limits apply to each part
+			var payload incrementalPayload
+			reader := c.limitBody(part)
+			err = c.codec.NewDecoder(reader).Decode(&payload)
+			part.Close()
+			if reader.err != nil {
+				deliver(Patch{Err: reader.err})
+				return
+			}
+			if err == io.EOF {
+				// empty part, sent to keep the connection alive
+				continue
+			}
+			if err != nil {
+				deliver(Patch{Err: errors.Wrap(err, "decoding response")})
+				return
+			}
+			c.logf("<< patch: hasNext=%t", payload.HasNext)
+			// a last payload with nothing in it still tells that the
+			// response is complete
+			if !payload.empty() || (len(payload.Incremental) == 0 && !payload.HasNext) {
+				hasNext := payload.HasNext || len(payload.Incremental) > 0
+				if !deliver(payload.patch(hasNext)) {
+					return
+				}
+			}
+			for i, patch := range payload.Incremental {
+				hasNext := payload.HasNext || i < len(payload.Incremental)-1
+				if !deliver(patch.patch(hasNext)) {
+					return
+				}
+			}
+			if !payload.HasNext {
+				return
+			}
+		}
+	}()
+	return patches, nil
+}
+
+// MergePatch merges patch into data, the data assembled from the patches
+// delivered before it, and returns the result. The data of a deferred
+// fragment is merged into the object at the path of the patch, and
+// streamed items are appended to the list at its path.
+func MergePatch(data json.RawMessage, patch Patch) (json.RawMessage, error) {
+	if len(data) == 0 || string(data) == "null" {
+		if len(patch.Path) == 0 {
+			return patch.Data, nil
+		}
+		return nil, errors.New("graphql: patch before the initial result")
+	}
+	var tree interface{}
+	if err := decodeNumbers(data, &tree); err != nil {
+		return nil, errors.Wrap(err, "graphql: decoding data")
+	}
+	var value interface{}
+	if len(patch.Data) > 0 {
+		if err := decodeNumbers(patch.Data, &value); err != nil {
+			return nil, errors.Wrap(err, "graphql: decoding patch")
+		}
+	}
+	items := make([]interface{}, len(patch.Items))
+	for i, item := range patch.Items {
+		if err := decodeNumbers(item, &items[i]); err != nil {
+			return nil, errors.Wrap(err, "graphql: decoding patch")
+		}
+	}
+	path := patch.Path
+	if len(items) > 0 && len(path) > 0 {
+		// the path of streamed items ends with the index of the first one
+		if _, ok := pathIndex(path[len(path)-1]); ok {
+			path = path[:len(path)-1]
+		}
+	}
+	tree, err := mergeAt(tree, path, value, items)
+	if err != nil {
+		return nil, errors.Wrapf(err, "graphql: merging patch at %v", patch.Path)
+	}
+	return json.Marshal(tree)
+}
+
+// mergeAt merges value into the object, or appends items to the list, at
+// path in tree.
+func mergeAt(tree interface{}, path []interface{}, value interface{}, items []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		if len(items) > 0 {
+			list, ok := tree.([]interface{})
+			if !ok {
+				return nil, errors.New("items for a value that is not a list")
+			}
+			return append(list, items...), nil
+		}
+		return mergeValues(tree, value), nil
+	}
+	switch node := tree.(type) {
+	case map[string]interface{}:
+		key, ok := path[0].(string)
+		if !ok {
+			return nil, errors.Errorf("index %v in an object", path[0])
+		}
+		child, err := mergeAt(node[key], path[1:], value, items)
+		if err != nil {
+			return nil, err
+		}
+		node[key] = child
+		return node, nil
+	case []interface{}:
+		index, ok := pathIndex(path[0])
+		if !ok || index < 0 || index >= len(node) {
+			return nil, errors.Errorf("index %v out of range", path[0])
+		}
+		child, err := mergeAt(node[index], path[1:], value, items)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	}
+	return nil, errors.Errorf("no value at %v", path[0])
+}
+
+// pathIndex returns the list index of a path element, which is a float64
+// once decoded from JSON.
+func pathIndex(element interface{}) (int, bool) {
+	switch index := element.(type) {
+	case float64:
+		return int(index), true
+	case int:
+		return index, true
+	case json.Number:
+		i, err := index.Int64()
+		return int(i), err == nil
+	}
+	return 0, false
+}
+
+// mergeValues deep merges the fields of patch into value.
+func mergeValues(value, patch interface{}) interface{} {
+	object, ok := value.(map[string]interface{})
+	fields, isObject := patch.(map[string]interface{})
+	if !ok || !isObject {
+		if patch == nil {
+			return value
+		}
+		return patch
+	}
+	for key, field := range fields {
+		object[key] = mergeValues(object[key], field)
+	}
+	return object
+}
+
+// decodeNumbers unmarshals data into v, keeping numbers as json.Number so
+// they are encoded again unchanged.
+func decodeNumbers(data json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,90 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRunIncremental(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.True(strings.HasPrefix(r.Header.Get("Accept"), "multipart/mixed"))
+		w.Header().Set("Content-Type", `multipart/mixed; boundary="-"; deferSpec=20220824`)
+		parts := []string{
+			`{"data":{"hero":{"name":"R2-D2","films":[]}},"hasNext":true}`,
+			`{"incremental":[{"data":{"height":96},"path":["hero"],"label":"details"}],"hasNext":true}`,
+			`{"incremental":[{"items":[{"title":"A New Hope"}],"path":["hero","films",0]},{"items":[{"title":"Return of the Jedi"}],"path":["hero","films",1]}],"hasNext":true}`,
+			`{"hasNext":false}`,
+		}
+		for _, part := range parts {
+			fmt.Fprintf(w, "\r\n---\r\nContent-Type: application/json; charset=utf-8\r\n\r\n%s", part)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "\r\n-----\r\n")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+	patches, err := client.RunIncremental(ctx, NewRequest(`query { hero { name ... @defer(label: "details") { height } films @stream { title } } }`))
+	is.NoErr(err)
+
+	var got []Patch
+	var data []byte
+	for patch := range patches {
+		is.NoErr(patch.Err)
+		got = append(got, patch)
+		data, err = MergePatch(data, patch)
+		is.NoErr(err)
+	}
+	is.Equal(len(got), 5)
+	is.True(got[0].HasNext)
+	is.Equal(got[1].Label, "details")
+	is.Equal(got[1].Path, []interface{}{"hero"})
+	is.Equal(len(got[2].Items), 1)
+	is.True(got[3].HasNext)
+	is.True(!got[4].HasNext)
+	is.Equal(string(data), `{"hero":{"films":[{"title":"A New Hope"},{"title":"Return of the Jedi"}],"height":96,"name":"R2-D2"}}`)
+}
+
+func TestRunIncrementalJSON(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data":{"hero":{"name":"R2-D2"}},"errors":[{"message":"no height"}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+	patches, err := client.RunIncremental(ctx, NewRequest(`query { hero { name } }`))
+	is.NoErr(err)
+
+	patch := <-patches
+	is.Equal(string(patch.Data), `{"hero":{"name":"R2-D2"}}`)
+	is.True(strings.Contains(patch.Err.Error(), "no height"))
+	is.True(!patch.HasNext)
+	_, ok := <-patches
+	is.True(!ok)
+}
+
+func TestMergePatchLegacyFormat(t *testing.T) {
+	is := is.New(t)
+	data, err := MergePatch(nil, Patch{Data: []byte(`{"heroes":[{"id":"1"},{"id":"2"}]}`), HasNext: true})
+	is.NoErr(err)
+	data, err = MergePatch(data, Patch{Data: []byte(`{"name":"Leia"}`), Path: []interface{}{"heroes", float64(1)}})
+	is.NoErr(err)
+	is.Equal(string(data), `{"heroes":[{"id":"1"},{"id":"2","name":"Leia"}]}`)
+
+	_, err = MergePatch(data, Patch{Data: []byte(`{}`), Path: []interface{}{"heroes", float64(5)}})
+	is.True(err != nil)
+}
@@ -0,0 +1,147 @@
+package graphql
+
+import (
+	"fmt"
+	"io"
+)
+
+// bodySnippetSize is how much of a response body errors keep.
+const bodySnippetSize = 4 << 10
+
+// ResponseLimitError is returned when a response is larger than the size
+// set with WithMaxResponseSize, or nested deeper than the depth set with
+// WithMaxResponseDepth. The response is not decoded. The limits apply to
+// each message of a subscription and each part of an incremental response.
+type ResponseLimitError struct {
+	// MaxSize is set when the response is too large, and MaxDepth when it
+	// is nested too deep.
+	MaxSize  int64
+	MaxDepth int
+	// Body is the start of the body of the response, up to 4KB.
+	Body []byte
+}
+
+func (e *ResponseLimitError) Error() string {
+	if e.MaxDepth > 0 {
+		return fmt.Sprintf("graphql: response nested deeper than %d levels: %s", e.MaxDepth, e.Body)
+	}
+	return fmt.Sprintf("graphql: response larger than %d bytes: %s", e.MaxSize, e.Body)
+}
+
+// WithMaxResponseSize fails responses whose body is larger than size
+// bytes, after decompression, with a *ResponseLimitError instead of
+// decoding them.
+func WithMaxResponseSize(size int64) ClientOption {
+	return func(client *clientImp) {
+		client.maxResponseSize = size
+	}
+}
+
+// WithMaxResponseDepth fails responses whose JSON objects and arrays are
+// nested deeper than depth levels, the response itself being the first,
+// with a *ResponseLimitError instead of decoding them.
+func WithMaxResponseDepth(depth int) ClientOption {
+	return func(client *clientImp) {
+		client.maxResponseDepth = depth
+	}
+}
+
+// limitReader reads a response body, failing once it goes over the size or
+// depth limits, if any. It keeps the start of the body for errors.
+type limitReader struct {
+	r        io.Reader
+	maxSize  int64
+	maxDepth int
+
+	read  int64
+	head  []byte
+	depth int
+	// inString and escaped track where the scan is in a string, whose
+	// brackets do not count
+	inString bool
+	escaped  bool
+	err      *ResponseLimitError
+}
+
+// limitBody returns body with the limits of the client applied.
+func (c *clientImp) limitBody(body io.Reader) *limitReader {
+	return &limitReader{
+		r:        body,
+		maxSize:  c.maxResponseSize,
+		maxDepth: c.maxResponseDepth,
+	}
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	n, err := l.r.Read(p)
+	l.keep(p[:n])
+	if l.maxSize > 0 && l.read+int64(n) > l.maxSize {
+		n = int(l.maxSize - l.read)
+		l.err = &ResponseLimitError{MaxSize: l.maxSize}
+	}
+	if l.maxDepth > 0 {
+		if i := l.scan(p[:n]); i >= 0 {
+			// too deep before going over the size
+			n = i
+			l.err = &ResponseLimitError{MaxDepth: l.maxDepth}
+		}
+	}
+	l.read += int64(n)
+	if l.err != nil {
+		l.err.Body = l.snippet()
+		return n, l.err
+	}
+	return n, err
+}
+
+// snippet returns the start of the body, reading up to 4KB of it, so that
+// errors show more of the body than was decoded.
+func (l *limitReader) snippet() []byte {
+	if room := bodySnippetSize - len(l.head); room > 0 {
+		rest := make([]byte, room)
+		n, _ := io.ReadFull(l.r, rest)
+		l.keep(rest[:n])
+	}
+	return l.head
+}
+
+// keep appends the start of b to the head of the body.
+func (l *limitReader) keep(b []byte) {
+	if room := bodySnippetSize - len(l.head); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		l.head = append(l.head, b...)
+	}
+}
+
+// scan tracks the nesting depth through b, returning the index of the
+// bracket going over the maximum depth, or -1.
+func (l *limitReader) scan(b []byte) int {
+	for i, c := range b {
+		switch {
+		case l.escaped:
+			l.escaped = false
+		case l.inString:
+			switch c {
+			case '\\':
+				l.escaped = true
+			case '"':
+				l.inString = false
+			}
+		case c == '"':
+			l.inString = true
+		case c == '{' || c == '[':
+			l.depth++
+			if l.depth > l.maxDepth {
+				return i
+			}
+		case c == '}' || c == ']':
+			l.depth--
+		}
+	}
+	return -1
+}
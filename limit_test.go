@@ -0,0 +1,179 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	is := is.New(t)
+	large := `{"data":{"value":"` + strings.Repeat("x", 10000) + `"}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Query().Get("size") == "large" {
+			io.WriteString(w, large)
+			return
+		}
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	for _, cached := range []bool{false, true} {
+		opts := []ClientOption{WithMaxResponseSize(1000)}
+		if cached {
+			opts = append(opts, WithDefaultResponseCache())
+		}
+		var responseData map[string]interface{}
+		client := NewClient(srv.URL, opts...)
+		is.NoErr(client.Run(ctx, NewRequest("query {}"), &responseData))
+		is.Equal(responseData["value"], "some data")
+
+		client = NewClient(srv.URL+"?size=large", opts...)
+		err := client.Run(ctx, NewRequest("query {}"), &responseData)
+		limitErr, ok := errors.Cause(err).(*ResponseLimitError)
+		is.True(ok)
+		is.Equal(limitErr.MaxSize, int64(1000))
+		is.Equal(limitErr.MaxDepth, 0)
+		is.Equal(string(limitErr.Body), large[:bodySnippetSize])
+		is.True(strings.Contains(err.Error(), "larger than 1000 bytes"))
+	}
+}
+
+func TestMaxResponseDepth(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("depth") == "deep" {
+			io.WriteString(w, `{"data":{"a":{"b":{"c":[1]}}}}`)
+			return
+		}
+		// brackets in strings do not count
+		io.WriteString(w, `{"data":{"a":{"b":"{[\"{[{["}}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var responseData map[string]interface{}
+	is.NoErr(NewClient(srv.URL, WithMaxResponseDepth(4)).Run(ctx, NewRequest("query {}"), &responseData))
+
+	err := NewClient(srv.URL+"?depth=deep", WithMaxResponseDepth(4)).Run(ctx, NewRequest("query {}"), &responseData)
+	limitErr, ok := errors.Cause(err).(*ResponseLimitError)
+	is.True(ok)
+	is.Equal(limitErr.MaxDepth, 4)
+	is.Equal(string(limitErr.Body), `{"data":{"a":{"b":{"c":[1]}}}}`)
+}
+
+func TestMaxResponseSizeStreams(t *testing.T) {
+	is := is.New(t)
+	large := `{"value":"` + strings.Repeat("x", 10000) + `"}`
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	// WebSocket subscriptions
+	wsSrv, _, _ := newSubscriptionServer(t, func(id string) []string {
+		return []string{large}
+	}, false)
+	defer wsSrv.Close()
+	results, err := NewClient(wsSrv.URL, WithMaxResponseSize(1000)).Subscribe(ctx, NewRequest("subscription { value }"))
+	is.NoErr(err)
+	limitErr, ok := (<-results).Err.(*ResponseLimitError)
+	is.True(ok)
+	is.Equal(limitErr.MaxSize, int64(1000))
+
+	// SSE subscriptions and incremental delivery
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Accept") {
+		case "text/event-stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: next\ndata: {\"data\":{\"value\":\"small\"}}\n\n")
+			io.WriteString(w, "event: next\ndata: {\"data\":"+large+"}\n\n")
+		default:
+			w.Header().Set("Content-Type", `multipart/mixed; boundary="-"`)
+			io.WriteString(w, "\r\n---\r\nContent-Type: application/json\r\n\r\n")
+			io.WriteString(w, `{"data":{"value":"small"},"hasNext":true}`)
+			io.WriteString(w, "\r\n---\r\nContent-Type: application/json\r\n\r\n")
+			io.WriteString(w, `{"incremental":[{"data":`+large+`,"path":[]}],"hasNext":false}`)
+			io.WriteString(w, "\r\n-----\r\n")
+		}
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithMaxResponseSize(1000), WithSubscriptionProtocols(GraphQLSSE))
+
+	results, err = client.Subscribe(ctx, NewRequest("subscription { value }"))
+	is.NoErr(err)
+	is.NoErr((<-results).Err)
+	limitErr, ok = (<-results).Err.(*ResponseLimitError)
+	is.True(ok)
+	is.Equal(limitErr.MaxSize, int64(1000))
+	is.True(len(limitErr.Body) > 1000)
+	is.True(strings.HasPrefix(`{"data":`+large, string(limitErr.Body)))
+	_, open := <-results
+	is.True(!open)
+
+	patches, err := client.RunIncremental(ctx, NewRequest("query { value }"))
+	is.NoErr(err)
+	is.NoErr((<-patches).Err)
+	limitErr, ok = (<-patches).Err.(*ResponseLimitError)
+	is.True(ok)
+	is.Equal(limitErr.MaxSize, int64(1000))
+	_, open = <-patches
+	is.True(!open)
+}
+
+func TestMaxResponseDepthStreams(t *testing.T) {
+	is := is.New(t)
+	deep := `{"data":{"a":{"b":{"c":[1]}}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Accept") {
+		case "text/event-stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: next\ndata: "+deep+"\n\n")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, deep)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithMaxResponseDepth(4), WithSubscriptionProtocols(GraphQLSSE))
+
+	results, err := client.Subscribe(ctx, NewRequest("subscription { a }"))
+	is.NoErr(err)
+	limitErr, ok := (<-results).Err.(*ResponseLimitError)
+	is.True(ok)
+	is.Equal(limitErr.MaxDepth, 4)
+
+	patches, err := client.RunIncremental(ctx, NewRequest("query { a }"))
+	is.NoErr(err)
+	limitErr, ok = (<-patches).Err.(*ResponseLimitError)
+	is.True(ok)
+	is.Equal(string(limitErr.Body), deep)
+}
+
+func TestReadEventsMaxSize(t *testing.T) {
+	is := is.New(t)
+	stream := "data: 12345\ndata: 67890\n\n" + "data: 12345\ndata: 678901\n\n"
+	var events []string
+	_, err := readEvents(strings.NewReader(stream), 11, func(event, data string) bool {
+		events = append(events, data)
+		return true
+	})
+	is.Equal(events, []string{"12345\n67890"})
+	limitErr, ok := err.(*ResponseLimitError)
+	is.True(ok)
+	is.Equal(string(limitErr.Body), "12345\n678901")
+}
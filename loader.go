@@ -0,0 +1,220 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultLoaderWait = 1 * time.Millisecond
+
+// LoaderRequestFunc builds a single request fetching all keys.
+type LoaderRequestFunc func(keys []string) *Request
+
+// LoaderSplitFunc splits the response data of a request built by a
+// LoaderRequestFunc into the result of each key. Keys missing from the
+// returned map fail to load.
+type LoaderSplitFunc func(keys []string, data json.RawMessage) (map[string]json.RawMessage, error)
+
+// Loader collects the keys loaded by concurrent callers for a short wait,
+// then fetches them all with a single request run through the Client.
+// Results are cached per key, so each key is fetched at most once per
+// Loader unless it is cleared.
+//
+//	loader := graphql.NewLoader(client, func(ids []string) *graphql.Request {
+//	    req := graphql.NewRequest(`query ($ids: [ID!]!) { assets(ids: $ids) { id name } }`)
+//	    req.Var("ids", ids)
+//	    return req
+//	}, splitAssetsByID)
+//
+//	var asset Asset
+//	err := loader.Load(ctx, "123", &asset)
+type Loader struct {
+	client   Client
+	build    LoaderRequestFunc
+	split    LoaderSplitFunc
+	wait     time.Duration
+	maxBatch int
+	noCache  bool
+
+	mu      sync.Mutex
+	results map[string]*loaderResult
+	// queued holds the results of the keys collected but not fetched yet.
+	queued  map[string]*loaderResult
+	batches *collector
+}
+
+// LoaderOption are functions that are passed into NewLoader to modify the
+// behaviour of the Loader.
+type LoaderOption func(*Loader)
+
+// WithLoaderWait sets how long the Loader collects keys before sending a
+// batch.
+func WithLoaderWait(wait time.Duration) LoaderOption {
+	return func(loader *Loader) {
+		loader.wait = wait
+	}
+}
+
+// WithLoaderMaxBatch limits the number of keys fetched by a single request.
+// A batch is sent as soon as it is full.
+func WithLoaderMaxBatch(maxBatch int) LoaderOption {
+	return func(loader *Loader) {
+		loader.maxBatch = maxBatch
+	}
+}
+
+// WithLoaderCacheDisabled fetches keys again on every Load instead of
+// caching their results.
+func WithLoaderCacheDisabled() LoaderOption {
+	return func(loader *Loader) {
+		loader.noCache = true
+	}
+}
+
+// NewLoader makes a new Loader that builds requests with build, runs them
+// with client and splits their response data with split.
+func NewLoader(client Client, build LoaderRequestFunc, split LoaderSplitFunc, opts ...LoaderOption) *Loader {
+	l := &Loader{
+		client:  client,
+		build:   build,
+		split:   split,
+		wait:    defaultLoaderWait,
+		results: make(map[string]*loaderResult),
+		queued:  make(map[string]*loaderResult),
+	}
+	for _, optionFunc := range opts {
+		optionFunc(l)
+	}
+	l.batches = newCollector(l.wait, l.maxBatch, l.fetch)
+	return l
+}
+
+// loaderResult is the result of a key and, once done is closed, its data.
+type loaderResult struct {
+	key  string
+	data json.RawMessage
+	err  error
+	done chan struct{}
+}
+
+// Load loads key and unmarshals its result into resp.
+// Pass in a nil response object to skip response parsing.
+func (l *Loader) Load(ctx context.Context, key string, resp interface{}) error {
+	result := l.enqueue(key)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-result.done:
+	}
+	if result.err != nil {
+		return result.err
+	}
+	if resp == nil {
+		return nil
+	}
+	return decodeClientData(l.client, result.data, resp)
+}
+
+// LoadMany loads keys and unmarshals their results into the response
+// objects at the same index. It returns one error per key, nil for the keys
+// that loaded successfully.
+func (l *Loader) LoadMany(ctx context.Context, keys []string, resps []interface{}) []error {
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i := range keys {
+		var resp interface{}
+		if resps != nil {
+			resp = resps[i]
+		}
+		wg.Add(1)
+		go func(i int, resp interface{}) {
+			defer wg.Done()
+			errs[i] = l.Load(ctx, keys[i], resp)
+		}(i, resp)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Clear removes key from the cache, so the next Load fetches it again.
+func (l *Loader) Clear(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.results, key)
+}
+
+// Prime adds the result of key to the cache, unless it is already cached.
+func (l *Loader) Prime(key string, data json.RawMessage) {
+	if l.noCache {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.results[key]; ok {
+		return
+	}
+	result := &loaderResult{data: data, done: make(chan struct{})}
+	close(result.done)
+	l.results[key] = result
+}
+
+// enqueue returns the cached result of key, or adds key to the current batch.
+func (l *Loader) enqueue(key string) *loaderResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if result, ok := l.results[key]; ok && !l.noCache {
+		return result
+	}
+	if result, ok := l.queued[key]; ok {
+		return result
+	}
+	result := &loaderResult{key: key, done: make(chan struct{})}
+	l.queued[key] = result
+	if !l.noCache {
+		l.results[key] = result
+	}
+	l.batches.add("", result)
+	return result
+}
+
+// fetch runs the request for a batch of results and resolves every one.
+func (l *Loader) fetch(ctx context.Context, items []interface{}) {
+	results := make([]*loaderResult, len(items))
+	keys := make([]string, len(items))
+	l.mu.Lock()
+	for i, item := range items {
+		results[i] = item.(*loaderResult)
+		keys[i] = results[i].key
+		delete(l.queued, keys[i])
+	}
+	l.mu.Unlock()
+	var data json.RawMessage
+	err := l.client.Run(ctx, l.build(keys), &data)
+	var values map[string]json.RawMessage
+	if err == nil {
+		values, err = l.split(keys, data)
+	}
+	for i, key := range keys {
+		result := results[i]
+		switch value, ok := values[key]; {
+		case err != nil:
+			result.err = err
+		case !ok:
+			result.err = fmt.Errorf("graphql: loader: no result for key %q", key)
+		default:
+			result.data = value
+		}
+		if result.err != nil {
+			// failures are not cached, so the key can be loaded again
+			l.mu.Lock()
+			if l.results[key] == result {
+				delete(l.results, key)
+			}
+			l.mu.Unlock()
+		}
+		close(result.done)
+	}
+}
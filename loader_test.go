@@ -0,0 +1,121 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+type testAsset struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func newAssetLoader(t *testing.T, opts ...LoaderOption) (*Loader, *[][]string, func()) {
+	is := is.New(t)
+	var mu sync.Mutex
+	var batches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables struct {
+				IDs []string `json:"ids"`
+			} `json:"variables"`
+		}
+		is.NoErr(json.NewDecoder(r.Body).Decode(&body))
+		ids := body.Variables.IDs
+		sort.Strings(ids)
+		mu.Lock()
+		batches = append(batches, ids)
+		mu.Unlock()
+		var assets []testAsset
+		for _, id := range ids {
+			if id != "404" {
+				assets = append(assets, testAsset{ID: id, Name: "asset " + id})
+			}
+		}
+		is.NoErr(json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"assets": assets},
+		}))
+	}))
+
+	client := NewClient(srv.URL)
+	build := func(ids []string) *Request {
+		req := NewRequest(`query ($ids: [ID!]!) { assets(ids: $ids) { id name } }`)
+		req.Var("ids", ids)
+		return req
+	}
+	split := func(ids []string, data json.RawMessage) (map[string]json.RawMessage, error) {
+		var resp struct {
+			Assets []json.RawMessage
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, err
+		}
+		values := make(map[string]json.RawMessage)
+		for _, raw := range resp.Assets {
+			var asset testAsset
+			if err := json.Unmarshal(raw, &asset); err != nil {
+				return nil, err
+			}
+			values[asset.ID] = raw
+		}
+		return values, nil
+	}
+	return NewLoader(client, build, split, opts...), &batches, srv.Close
+}
+
+func TestLoader(t *testing.T) {
+	is := is.New(t)
+	loader, batches, closeServer := newAssetLoader(t, WithLoaderWait(20*time.Millisecond))
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	keys := []string{"1", "2", "1", "404"}
+	assets := make([]testAsset, len(keys))
+	resps := make([]interface{}, len(keys))
+	for i := range assets {
+		resps[i] = &assets[i]
+	}
+	errs := loader.LoadMany(ctx, keys, resps)
+	is.Equal(*batches, [][]string{{"1", "2", "404"}})
+	is.NoErr(errs[0])
+	is.NoErr(errs[1])
+	is.NoErr(errs[2])
+	is.True(errs[3] != nil) // missing from the response
+	is.Equal(assets[0].Name, "asset 1")
+	is.Equal(assets[1].Name, "asset 2")
+	is.Equal(assets[2].Name, "asset 1")
+
+	var asset testAsset
+	is.NoErr(loader.Load(ctx, "2", &asset))
+	is.Equal(asset.Name, "asset 2")
+	is.Equal(len(*batches), 1) // cached
+
+	loader.Clear("2")
+	is.NoErr(loader.Load(ctx, "2", &asset))
+	is.Equal(len(*batches), 2)
+}
+
+func TestLoaderMaxBatch(t *testing.T) {
+	is := is.New(t)
+	loader, batches, closeServer := newAssetLoader(t, WithLoaderWait(time.Minute), WithLoaderMaxBatch(2))
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	errs := loader.LoadMany(ctx, []string{"1", "2", "3", "4"}, nil)
+	for _, err := range errs {
+		is.NoErr(err)
+	}
+	is.Equal(len(*batches), 2)
+}
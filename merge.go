@@ -0,0 +1,330 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RunMerged runs requests that share the same document as a single request,
+// which works against servers that do not support batching. Every root
+// field of the document is aliased once per request and the variables are
+// renamed, so running
+//
+//	query ($id: ID!) { item(id: $id) { name } }
+//
+// for two IDs sends
+//
+//	query ($id_0: ID!, $id_1: ID!) { q0_item: item(id: $id_0) { name } q1_item: item(id: $id_1) { name } }
+//
+// The response is split back into the response object at the same index.
+// Pass a nil resps, or nil entries in it, to skip response parsing.
+// All requests must have the same headers.
+//
+// Like RunBatch, RunMerged returns a *BatchError when some of the requests
+// failed. The errors of the response are given to the request whose alias
+// starts their path, with the path changed back to the root field of the
+// request; the other errors are given to every request.
+func RunMerged(ctx context.Context, client Client, reqs []*Request, resps []interface{}) error {
+	if resps != nil && len(resps) != len(reqs) {
+		return fmt.Errorf("merge has %d requests but %d responses", len(reqs), len(resps))
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	merged, err := mergeRequests(reqs)
+	if err != nil {
+		return err
+	}
+
+	var data map[string]json.RawMessage
+	response := &Response{Data: &data}
+	if err := client.Run(ctx, merged, response); err != nil && len(response.Errors) == 0 {
+		return err
+	}
+	errs := splitMergedErrors(response.Errors, len(reqs))
+	for i, resp := range resps {
+		if resp == nil || data == nil {
+			continue
+		}
+		prefix := mergeAlias(i, "")
+		fields := make(map[string]json.RawMessage)
+		for key, value := range data {
+			if strings.HasPrefix(key, prefix) {
+				fields[strings.TrimPrefix(key, prefix)] = value
+			}
+		}
+		b, errSplit := json.Marshal(fields)
+		if errSplit == nil {
+			errSplit = decodeClientData(client, b, resp)
+		}
+		if errSplit != nil && errs[i] == nil {
+			errs[i] = errors.Wrap(errSplit, "decode response")
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// splitMergedErrors returns the errors of each of the n merged requests.
+func splitMergedErrors(list []GraphQLError, n int) []error {
+	lists := make([][]GraphQLError, n)
+	for _, gqlErr := range list {
+		i, key, ok := splitMergeAlias(gqlErr.Path, n)
+		if !ok {
+			for j := range lists {
+				lists[j] = append(lists[j], gqlErr)
+			}
+			continue
+		}
+		gqlErr.Path = append([]interface{}{key}, gqlErr.Path[1:]...)
+		lists[i] = append(lists[i], gqlErr)
+	}
+	errs := make([]error, n)
+	for i, l := range lists {
+		if len(l) > 0 {
+			errs[i] = getAggrErr(l)
+		}
+	}
+	return errs
+}
+
+// splitMergeAlias returns the request and the root field aliased by the
+// first element of path, if it is the alias of one of the n requests.
+func splitMergeAlias(path []interface{}, n int) (int, string, bool) {
+	if len(path) == 0 {
+		return 0, "", false
+	}
+	alias, ok := path[0].(string)
+	sep := strings.Index(alias, "_")
+	if !ok || sep < 1 || alias[0] != 'q' {
+		return 0, "", false
+	}
+	i, err := strconv.Atoi(alias[1:sep])
+	if err != nil || i < 0 || i >= n || mergeAlias(i, "") != alias[:sep+1] {
+		return 0, "", false
+	}
+	return i, alias[sep+1:], true
+}
+
+func mergeAlias(i int, key string) string {
+	return fmt.Sprintf("q%d_%s", i, key)
+}
+
+func mergeVariable(i int, name string) string {
+	return fmt.Sprintf("%s_%d", name, i)
+}
+
+// mergeRequests rewrites requests for the same document into one request.
+func mergeRequests(reqs []*Request) (*Request, error) {
+	doc, err := parseMergeDocument(reqs[0].q)
+	if err != nil {
+		return nil, err
+	}
+	merged := NewRequest("")
+	header := make(http.Header)
+	for key, values := range reqs[0].Header {
+		header[key] = append([]string(nil), values...)
+	}
+	merged.Header = header
+
+	var varDefs, selections bytes.Buffer
+	for i, req := range reqs {
+		if req.q != reqs[0].q {
+			return nil, fmt.Errorf("request %d has a different document", i)
+		}
+		if headerKey(req.Header) != headerKey(reqs[0].Header) {
+			return nil, fmt.Errorf("request %d has different headers", i)
+		}
+		if len(req.files) > 0 {
+			return nil, fmt.Errorf("request %d has files", i)
+		}
+		for name, value := range req.vars {
+			merged.Var(mergeVariable(i, name), value)
+		}
+		if doc.hasVarDefs {
+			varDefs.WriteString(" ")
+			varDefs.WriteString(doc.rewrite(doc.varDefsOpen, doc.varDefsClose, i))
+		}
+		selections.WriteString(" ")
+		selections.WriteString(doc.rewrite(doc.selOpen, doc.selClose, i))
+	}
+
+	var q bytes.Buffer
+	q.WriteString(doc.src[:doc.tokens[doc.opStart].Start])
+	if doc.hasVarDefs {
+		q.WriteString(doc.src[doc.tokens[doc.opStart].Start:doc.tokens[doc.varDefsOpen].End])
+		q.WriteString(varDefs.String())
+		q.WriteString(" ")
+		q.WriteString(doc.src[doc.tokens[doc.varDefsClose].Start:doc.tokens[doc.selOpen].End])
+	} else {
+		q.WriteString(doc.src[doc.tokens[doc.opStart].Start:doc.tokens[doc.selOpen].End])
+	}
+	q.WriteString(selections.String())
+	q.WriteString(" ")
+	q.WriteString(doc.src[doc.tokens[doc.selClose].Start:])
+	merged.q = q.String()
+	return merged, nil
+}
+
+// mergeDocument locates, by token index, the parts of a single operation
+// document that are rewritten when merging.
+type mergeDocument struct {
+	src    string
+	tokens []token
+
+	opStart      int
+	hasVarDefs   bool
+	varDefsOpen  int
+	varDefsClose int
+	selOpen      int
+	selClose     int
+	// rootFields maps the token index where each root selection starts to
+	// the field, so it can be aliased.
+	rootFields map[int]rootField
+}
+
+type rootField struct {
+	// name is the token index of the field name, after any alias.
+	name int
+	// key is the response key of the field.
+	key string
+}
+
+func parseMergeDocument(src string) (*mergeDocument, error) {
+	doc := &mergeDocument{
+		src:        src,
+		tokens:     lex(src),
+		opStart:    -1,
+		rootFields: make(map[int]rootField),
+	}
+	tokens := doc.tokens
+
+	// find the operation, checking fragments do not use variables
+	for i := 0; i < len(tokens); {
+		tok := tokens[i]
+		isFragment := tok.Kind == tokenName && tok.Value == "fragment"
+		if !isFragment {
+			if doc.opStart >= 0 {
+				return nil, errors.New("cannot merge documents with more than one operation")
+			}
+			doc.opStart = i
+		}
+		for ; i < len(tokens) && tokens[i].Value != "{"; i++ {
+			// variable definitions directly follow the operation type or name
+			if !isFragment && tokens[i].Value == "(" && i <= doc.opStart+2 && !doc.hasVarDefs {
+				doc.hasVarDefs = true
+				doc.varDefsOpen = i
+				doc.varDefsClose = matchingToken(tokens, i)
+				if doc.varDefsClose < 0 {
+					return nil, errors.New("unterminated variable definitions")
+				}
+				i = doc.varDefsClose
+			}
+		}
+		if i == len(tokens) {
+			return nil, errors.New("missing selection set")
+		}
+		end := matchingToken(tokens, i)
+		if end < 0 {
+			return nil, errors.New("unterminated selection set")
+		}
+		if isFragment {
+			for j := i; j < end; j++ {
+				if tokens[j].Value == "$" {
+					return nil, errors.New("cannot merge documents with variables in fragments")
+				}
+			}
+		} else {
+			doc.selOpen, doc.selClose = i, end
+		}
+		i = end + 1
+	}
+	if doc.opStart < 0 {
+		return nil, errors.New("missing operation")
+	}
+	if tokens[doc.opStart].Value == "subscription" {
+		return nil, errors.New("cannot merge subscriptions")
+	}
+
+	// find the root selections
+	depth := 0
+	for i := doc.selOpen + 1; i < doc.selClose; i++ {
+		tok := tokens[i]
+		switch tok.Value {
+		case "{", "(", "[":
+			depth++
+			continue
+		case "}", ")", "]":
+			depth--
+			continue
+		case "...":
+			if depth == 0 {
+				return nil, errors.New("cannot merge documents with fragments at the root")
+			}
+		}
+		if depth > 0 || tok.Kind != tokenName || tokens[i-1].Value == "@" {
+			continue
+		}
+		field := rootField{name: i, key: tok.Value}
+		if i+2 < doc.selClose && tokens[i+1].Value == ":" {
+			field.name = i + 2
+		}
+		doc.rootFields[i] = field
+		i = field.name
+	}
+	return doc, nil
+}
+
+// matchingToken returns the index of the token closing the bracket opened
+// at open, or -1.
+func matchingToken(tokens []token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i].Value {
+		case "{", "(", "[":
+			depth++
+		case "}", ")", "]":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// rewrite returns the source between the tokens open and close, exclusive,
+// for request i: variables are renamed and root fields aliased.
+func (doc *mergeDocument) rewrite(open, close int, i int) string {
+	var b bytes.Buffer
+	pos := doc.tokens[open].End
+	for t := open + 1; t < close; t++ {
+		tok := doc.tokens[t]
+		b.WriteString(doc.src[pos:tok.Start])
+		if field, ok := doc.rootFields[t]; ok {
+			b.WriteString(mergeAlias(i, field.key))
+			b.WriteString(": ")
+			t = field.name
+			tok = doc.tokens[t]
+		}
+		if tok.Kind == tokenName && doc.tokens[t-1].Value == "$" {
+			b.WriteString(mergeVariable(i, tok.Value))
+		} else {
+			b.WriteString(tok.Value)
+		}
+		pos = tok.End
+	}
+	b.WriteString(doc.src[pos:doc.tokens[close].Start])
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestMergeRequests(t *testing.T) {
+	is := is.New(t)
+	q := `query Items($id: ID!, $withName: Boolean = false) {
+		item(id: $id) { id name @include(if: $withName) ...itemFields }
+		other: item(id: "fixed") { id }
+	}
+	fragment itemFields on Item { createdAt }`
+	var reqs []*Request
+	for _, id := range []string{"a", "b"} {
+		req := NewRequest(q)
+		req.Var("id", id)
+		reqs = append(reqs, req)
+	}
+	reqs[0].Var("withName", true)
+
+	merged, err := mergeRequests(reqs)
+	is.NoErr(err)
+	is.Equal(strings.Join(strings.Fields(merged.q), " "), "query Items( $id_0: ID!, $withName_0: Boolean = false $id_1: ID!, $withName_1: Boolean = false ) { "+
+		"q0_item: item(id: $id_0) { id name @include(if: $withName_0) ...itemFields } q0_other: item(id: \"fixed\") { id } "+
+		"q1_item: item(id: $id_1) { id name @include(if: $withName_1) ...itemFields } q1_other: item(id: \"fixed\") { id } } "+
+		"fragment itemFields on Item { createdAt }")
+	is.Equal(merged.vars, map[string]interface{}{"id_0": "a", "withName_0": true, "id_1": "b"})
+}
+
+func TestMergeRequestsUnsupported(t *testing.T) {
+	is := is.New(t)
+	for _, q := range []string{
+		`query { ...rootFields } fragment rootFields on Query { a }`,
+		`query ($id: ID!) { a { ...f } } fragment f on A { b(id: $id) }`,
+		`query { a } query { b }`,
+		`subscription { changed }`,
+	} {
+		_, err := mergeRequests([]*Request{NewRequest(q)})
+		is.True(err != nil)
+	}
+	_, err := mergeRequests([]*Request{NewRequest(`{ a }`), NewRequest(`{ b }`)})
+	is.True(err != nil) // different documents
+
+	withHeader := NewRequest(`{ a }`)
+	withHeader.Header.Set("Authorization", "Bearer token")
+	_, err = mergeRequests([]*Request{NewRequest(`{ a }`), withHeader})
+	is.True(err != nil) // different headers
+}
+
+func TestRunMerged(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var body batchOperation
+		is.NoErr(json.NewDecoder(r.Body).Decode(&body))
+		is.Equal(body.Query, `{ q0_item: item { value } q1_item: item { value } }`)
+		io.WriteString(w, `{"data":{"q0_item":{"value":"one"},"q1_item":{"value":"two"}}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	var first, second struct {
+		Item struct {
+			Value string
+		}
+	}
+	err := RunMerged(ctx, client, []*Request{NewRequest(`{item { value }}`), NewRequest(`{item { value }}`)}, []interface{}{&first, &second})
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(first.Item.Value, "one")
+	is.Equal(second.Item.Value, "two")
+}
+
+func TestRunMergedErrors(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"q0_item":{"value":"one"},"q1_item":null,"q2_item":{"value":"three"}},`+
+			`"errors":[{"message":"no item","path":["q1_item","value"]}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	q := `{item { value }}`
+	var first, second, third map[string]interface{}
+	err := RunMerged(ctx, client, []*Request{NewRequest(q), NewRequest(q), NewRequest(q)}, []interface{}{&first, &second, &third})
+	batchErr, ok := err.(*BatchError)
+	is.True(ok)
+	is.Equal(len(batchErr.Errors), 3)
+	is.NoErr(batchErr.Errors[0])
+	is.True(strings.Contains(batchErr.Errors[1].Error(), "no item"))
+	is.NoErr(batchErr.Errors[2])
+	is.Equal(first["item"], map[string]interface{}{"value": "one"})
+	is.Equal(third["item"], map[string]interface{}{"value": "three"})
+
+	errs := splitMergedErrors([]GraphQLError{
+		{Message: "first", Path: []interface{}{"q0_item", "value"}},
+		{Message: "not merged", Path: []interface{}{"q01_item"}},
+		{Message: "everyone"},
+	}, 2)
+	is.True(strings.Contains(errs[0].Error(), "first"))
+	is.True(strings.Contains(errs[0].Error(), "everyone"))
+	is.True(!strings.Contains(errs[1].Error(), "first"))
+	is.True(strings.Contains(errs[1].Error(), "not merged"))
+	is.True(strings.Contains(errs[1].Error(), "everyone"))
+}
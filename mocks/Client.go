@@ -25,6 +25,66 @@ func (_m *Client) Run(ctx context.Context, req *graphql.Request, resp interface{
 	return r0
 }
 
+// RunBatch provides a mock function with given fields: ctx, reqs, resps
+func (_m *Client) RunBatch(ctx context.Context, reqs []*graphql.Request, resps []interface{}) error {
+	ret := _m.Called(ctx, reqs, resps)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []*graphql.Request, []interface{}) error); ok {
+		r0 = rf(ctx, reqs, resps)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Subscribe provides a mock function with given fields: ctx, req
+func (_m *Client) Subscribe(ctx context.Context, req *graphql.Request) (<-chan graphql.Result, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 <-chan graphql.Result
+	if rf, ok := ret.Get(0).(func(context.Context, *graphql.Request) <-chan graphql.Result); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan graphql.Result)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *graphql.Request) error); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RunIncremental provides a mock function with given fields: ctx, req
+func (_m *Client) RunIncremental(ctx context.Context, req *graphql.Request) (<-chan graphql.Patch, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 <-chan graphql.Patch
+	if rf, ok := ret.Get(0).(func(context.Context, *graphql.Request) <-chan graphql.Patch); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan graphql.Patch)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *graphql.Request) error); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SetLogger provides a mock function with given fields: _a0
 func (_m *Client) SetLogger(_a0 func(string)) {
 	_m.Called(_a0)
@@ -0,0 +1,100 @@
+package graphql
+
+import (
+	"io"
+	"time"
+)
+
+// Progress is the progress of the upload of the files of a request,
+// reported to the function set with Request.OnProgress.
+type Progress struct {
+	// Field and Name are those of the file being uploaded.
+	Field string
+	Name  string
+	// FileSent is the number of bytes of the file sent so far, out of
+	// FileTotal, which is -1 if the size of the file is not known.
+	FileSent  int64
+	FileTotal int64
+	// Sent is the number of bytes of all the files sent so far, out of
+	// Total, which is -1 if the size of any file is not known.
+	Sent  int64
+	Total int64
+	// Elapsed is the time since the upload started.
+	Elapsed time.Duration
+	// Rate is the average throughput so far, in bytes per second.
+	Rate float64
+	// Remaining is the estimated time left, or zero if it is not known.
+	Remaining time.Duration
+}
+
+// OnProgress sets a function called as the files of the request are
+// uploaded. It is called from the goroutine sending the request. If the
+// request is retried, progress starts over with each attempt.
+func (req *Request) OnProgress(fn func(Progress)) {
+	req.progress = fn
+}
+
+// progressReporter reports the progress of an attempt to upload files.
+type progressReporter struct {
+	fn    func(Progress)
+	start time.Time
+	sent  int64
+	total int64
+}
+
+func newProgressReporter(fn func(Progress), files []*formFile) *progressReporter {
+	p := &progressReporter{
+		fn:    fn,
+		start: time.Now(),
+	}
+	for _, f := range files {
+		if f.size < 0 {
+			p.total = -1
+			break
+		}
+		p.total += f.size
+	}
+	return p
+}
+
+// reader reports the progress of f as src is read.
+func (p *progressReporter) reader(f *formFile, src io.Reader) io.Reader {
+	return &progressReader{
+		reporter: p,
+		src:      src,
+		progress: Progress{
+			Field:     f.field,
+			Name:      f.file.Name,
+			FileTotal: f.size,
+		},
+	}
+}
+
+func (p *progressReporter) report(progress Progress) {
+	progress.Sent = p.sent
+	progress.Total = p.total
+	progress.Elapsed = time.Since(p.start)
+	if seconds := progress.Elapsed.Seconds(); seconds > 0 {
+		progress.Rate = float64(p.sent) / seconds
+	}
+	if p.total >= 0 && progress.Rate > 0 {
+		progress.Remaining = time.Duration(float64(p.total-p.sent) / progress.Rate * float64(time.Second))
+	}
+	p.fn(progress)
+}
+
+type progressReader struct {
+	reporter *progressReporter
+	src      io.Reader
+	progress Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.src.Read(b)
+	if n > 0 {
+		r.progress.FileSent += int64(n)
+		r.reporter.sent += int64(n)
+		r.reporter.report(r.progress)
+	}
+	return n, err
+}
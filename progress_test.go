@@ -0,0 +1,81 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestUploadProgress(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.NoErr(r.ParseMultipartForm(1 << 20))
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartForm())
+
+	first := strings.Repeat("a", 100000)
+	second := strings.Repeat("b", 50000)
+	req := NewRequest("mutation { upload }")
+	req.File("first", "first.txt", strings.NewReader(first))
+	req.FileFunc("second", "second.txt", func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(second)), nil
+	})
+	req.files[1].Size = int64(len(second))
+	var reports []Progress
+	req.OnProgress(func(progress Progress) {
+		reports = append(reports, progress)
+	})
+	is.NoErr(client.Run(ctx, req, nil))
+
+	is.True(len(reports) > 2)
+	var sent int64
+	for _, progress := range reports {
+		is.True(progress.Sent > sent)
+		sent = progress.Sent
+		is.Equal(progress.Total, int64(150000))
+	}
+	last := reports[len(reports)-1]
+	is.Equal(last.Name, "second.txt")
+	is.Equal(last.FileSent, int64(50000))
+	is.Equal(last.FileTotal, int64(50000))
+	is.Equal(last.Sent, int64(150000))
+	is.Equal(last.Remaining, time.Duration(0))
+	is.True(last.Rate > 0)
+}
+
+func TestUploadProgressUnknownSize(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.NoErr(r.ParseMultipartForm(1 << 20))
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartForm())
+
+	req := NewRequest("mutation { upload }")
+	req.File("file", "file.txt", onlyReader{strings.NewReader("contents")})
+	var last Progress
+	req.OnProgress(func(progress Progress) {
+		last = progress
+	})
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(last.FileSent, int64(8))
+	is.Equal(last.FileTotal, int64(-1))
+	is.Equal(last.Total, int64(-1))
+	is.Equal(last.Remaining, time.Duration(0))
+}
@@ -0,0 +1,121 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Response is the whole response to a request. Pass a *Response to Run as
+// the response object to get the errors and extensions of the response as
+// well as its data, which is unmarshalled into Data unless it is nil. Run
+// still returns an error if the response has errors.
+//
+//	var data ResponseStruct
+//	resp := &graphql.Response{Data: &data}
+//	err := client.Run(ctx, req, resp)
+type Response struct {
+	Data       interface{}
+	Errors     []GraphQLError
+	Extensions map[string]interface{}
+	// RawData is the data of the response as it was received, and RawBody
+	// the whole body of the response.
+	RawData json.RawMessage
+	RawBody []byte
+	// StatusCode and Header are those of the HTTP response.
+	StatusCode int
+	Header     http.Header
+	// Duration is the time the request took, retries included, and Attempts
+	// the number of times it was sent.
+	Duration time.Duration
+	Attempts int
+}
+
+// UnmarshalJSON decodes the body of the response, keeping it undecoded in
+// RawBody and its data in RawData.
+func (r *Response) UnmarshalJSON(b []byte) error {
+	return r.decode(b, json.Unmarshal, func(data json.RawMessage, v interface{}) error {
+		return json.Unmarshal(data, v)
+	})
+}
+
+// decode decodes the body b of the response with unmarshal, then its data
+// with decodeData.
+func (r *Response) decode(b []byte, unmarshal func([]byte, interface{}) error, decodeData func(json.RawMessage, interface{}) error) error {
+	var envelope struct {
+		Data       json.RawMessage        `json:"data"`
+		Errors     []GraphQLError         `json:"errors"`
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	if err := unmarshal(b, &envelope); err != nil {
+		return err
+	}
+	r.RawBody = append([]byte(nil), b...)
+	r.RawData = envelope.Data
+	r.Errors = envelope.Errors
+	r.Extensions = envelope.Extensions
+	if r.Data == nil || !hasData(r.RawData) {
+		return nil
+	}
+	return decodeData(r.RawData, r.Data)
+}
+
+func (r *Response) reset() {
+	r.Errors = nil
+	r.Extensions = nil
+	r.RawData = nil
+	r.RawBody = nil
+	r.StatusCode = 0
+	r.Header = nil
+}
+
+func (r *Response) err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return getAggrErr(r.Errors)
+}
+
+func (r *Response) retryable() bool {
+	return shouldRetry(r.Errors)
+}
+
+// newResponseBody returns what the body of the response to a request run
+// with resp is decoded into.
+func newResponseBody(resp interface{}) responseBody {
+	if response, ok := resp.(*Response); ok {
+		return response
+	}
+	return &graphResponse{
+		Data: resp,
+	}
+}
+
+// lookupPath returns the value at path in data. Path elements are object
+// keys, or indexes in lists.
+func lookupPath(data json.RawMessage, path []string) (json.RawMessage, error) {
+	value := data
+	for i, key := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err == nil {
+			var ok bool
+			if value, ok = object[key]; !ok {
+				return nil, errors.Errorf("graphql: no %q in data at %v", key, path[:i])
+			}
+			continue
+		}
+		var list []json.RawMessage
+		if err := json.Unmarshal(value, &list); err != nil {
+			return nil, errors.Errorf("graphql: no %q in data at %v", key, path[:i])
+		}
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(list) {
+			return nil, errors.Errorf("graphql: no %q in data at %v", key, path[:i])
+		}
+		value = list[index]
+	}
+	return value, nil
+}
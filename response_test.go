@@ -0,0 +1,73 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRunResponse(t *testing.T) {
+	is := is.New(t)
+	body := `{"data":{"zebra":1,"id":12345678901234567890,"apple":{"b":0.10,"a":[]}},"extensions":{"cost":3}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	var resp Response
+	is.NoErr(client.Run(ctx, NewRequest("query { zebra id apple { b a } }"), &resp))
+	is.Equal(string(resp.RawData), `{"zebra":1,"id":12345678901234567890,"apple":{"b":0.10,"a":[]}}`)
+	is.Equal(string(resp.RawBody), body)
+	is.Equal(resp.Data, nil)
+	is.Equal(resp.Extensions["cost"], float64(3))
+
+	var data struct {
+		Zebra int
+	}
+	resp = Response{Data: &data}
+	is.NoErr(client.Run(ctx, NewRequest("query { zebra id apple { b a } }"), &resp))
+	is.Equal(data.Zebra, 1)
+	is.Equal(string(resp.RawData), `{"zebra":1,"id":12345678901234567890,"apple":{"b":0.10,"a":[]}}`)
+}
+
+func TestRunResponseMetadata(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Request-Id", "req-123")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTestDuration(1))
+	defer cancel()
+	retryConfig := RetryConfig{
+		MaxTries: 2,
+		Interval: 1,
+		Policy:   Linear,
+	}
+	client := NewClient(srv.URL, WithRetryConfig(retryConfig))
+
+	var resp Response
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), &resp))
+	is.Equal(resp.StatusCode, http.StatusAccepted)
+	is.Equal(resp.Header.Get("X-Request-Id"), "req-123")
+	is.Equal(resp.Attempts, 2)
+	is.True(resp.Duration >= time.Second)
+}
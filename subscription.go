@@ -0,0 +1,138 @@
+package graphql
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSubscriptionIdleTimeout = 5 * time.Second
+	defaultSubscriptionBufferSize  = 64
+)
+
+// ErrSlowConsumer ends a subscription whose results are not received fast
+// enough to keep up with the server.
+var ErrSlowConsumer = errors.New("subscription results not consumed fast enough")
+
+// Result is a single result delivered by a subscription.
+type Result struct {
+	// Data is the undecoded data of the result.
+	Data json.RawMessage
+	// Err holds the GraphQL errors of the result, or the error that ended
+	// the subscription.
+	Err error
+	// Reconnected is set on a result without data delivered after the
+	// connection dropped and the subscription was started again.
+	Reconnected bool
+
+	// decode decodes the data with the codec and decoding options of the
+	// client.
+	decode func(data json.RawMessage, v interface{}) error
+}
+
+// Decode unmarshals the data of the result into v, the same way Run
+// decodes the data of a response.
+func (r Result) Decode(v interface{}) error {
+	if len(r.Data) == 0 {
+		return nil
+	}
+	if r.decode != nil {
+		return r.decode(r.Data, v)
+	}
+	return json.Unmarshal(r.Data, v)
+}
+
+// newResult decodes a GraphQL response payload the same way Run does.
+func (c *clientImp) newResult(payload json.RawMessage) Result {
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []GraphQLError  `json:"errors"`
+	}
+	if err := c.unmarshal(payload, &envelope); err != nil {
+		return Result{Err: err}
+	}
+	result := Result{Data: envelope.Data, decode: c.decodeData}
+	if len(envelope.Errors) > 0 {
+		result.Err = getAggrErr(envelope.Errors)
+	}
+	return result
+}
+
+// SubscriptionProtocol is a protocol for running subscriptions.
+type SubscriptionProtocol string
+
+const (
+	// GraphQLTransportWS is the graphql-transport-ws WebSocket protocol.
+	GraphQLTransportWS SubscriptionProtocol = "graphql-transport-ws"
+	// SubscriptionsTransportWS is the legacy Apollo subscriptions-transport-ws
+	// protocol, which is negotiated as the graphql-ws WebSocket subprotocol.
+	SubscriptionsTransportWS SubscriptionProtocol = "graphql-ws"
+	// GraphQLSSE is the GraphQL over Server-Sent Events protocol, in its
+	// distinct connections mode, for networks that block WebSockets.
+	GraphQLSSE SubscriptionProtocol = "graphql-sse"
+)
+
+var defaultSubscriptionProtocols = []SubscriptionProtocol{GraphQLTransportWS, SubscriptionsTransportWS}
+
+// WithSubscriptionProtocols sets the protocols offered to the server for
+// subscriptions, in order of preference. The server picks one through the
+// WebSocket subprotocol header. By default both GraphQLTransportWS and
+// SubscriptionsTransportWS are offered. Subscriptions are sent over
+// Server-Sent Events instead if GraphQLSSE comes first.
+func WithSubscriptionProtocols(protocols ...SubscriptionProtocol) ClientOption {
+	return func(client *clientImp) {
+		client.subscriptionProtocols = protocols
+	}
+}
+
+// WithSubscriptionKeepAlive treats a subscription connection as dropped
+// when nothing is received from the server for timeout. With the
+// graphql-transport-ws protocol the client pings the server to keep it
+// talking; with subscriptions-transport-ws the server must send keep-alives.
+func WithSubscriptionKeepAlive(timeout time.Duration) ClientOption {
+	return func(client *clientImp) {
+		client.subscriptionKeepAlive = timeout
+	}
+}
+
+// WithSubscriptionIdleTimeout sets how long a subscription connection is
+// kept open after its last subscription has ended, so subscriptions that
+// follow can reuse it. A zero timeout closes it right away. The default is
+// 5 seconds.
+func WithSubscriptionIdleTimeout(timeout time.Duration) ClientOption {
+	return func(client *clientImp) {
+		client.subscriptionIdleTimeout = timeout
+	}
+}
+
+// WithSubscriptionBufferSize sets how many results are buffered for each
+// subscription. A subscription is ended with ErrSlowConsumer once its buffer
+// is full. The default is 64.
+func WithSubscriptionBufferSize(size int) ClientOption {
+	return func(client *clientImp) {
+		client.subscriptionBufferSize = size
+	}
+}
+
+// WithSubscriptionEndpoint sets the endpoint used for subscriptions, if it
+// is not the endpoint of the client with a ws:// or wss:// scheme.
+func WithSubscriptionEndpoint(endpoint string) ClientOption {
+	return func(client *clientImp) {
+		client.subscriptionEndpoint = endpoint
+	}
+}
+
+// websocketURL turns an http:// or https:// endpoint into its WebSocket
+// equivalent.
+func websocketURL(endpoint string) string {
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		return "wss://" + strings.TrimPrefix(endpoint, "https://")
+	case strings.HasPrefix(endpoint, "http://"):
+		return "ws://" + strings.TrimPrefix(endpoint, "http://")
+	}
+	return endpoint
+}
@@ -0,0 +1,213 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// subscribeSSE runs a subscription over Server-Sent Events, in the
+// distinct connections mode of the GraphQL over SSE protocol: each
+// subscription is its own request, whose response streams the results.
+func (c *clientImp) subscribeSSE(ctx context.Context, req *Request, payload json.RawMessage) (<-chan Result, error) {
+	resp, err := c.postSSE(ctx, req, payload)
+	if err != nil {
+		return nil, err
+	}
+	c.logf(">> subscribe: %s", req.q)
+	results := make(chan Result)
+	go c.readSSE(ctx, req, payload, resp, results)
+	return results, nil
+}
+
+// postSSE sends the subscription and checks that the server answers with an
+// event stream.
+func (c *clientImp) postSSE(ctx context.Context, req *Request, payload json.RawMessage) (*http.Response, error) {
+	r, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	r = c.prepareRequest(r.WithContext(ctx), "application/json; charset=utf-8", req.Header)
+	r.Header.Set("Accept", "text/event-stream")
+	c.logf(">> sse: %s", c.endpoint)
+	resp, err := c.send(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "subscribe")
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, errors.Wrap(newHTTPError(resp, c.limitBody(resp.Body).snippet(), nil), "subscribe")
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		resp.Body.Close()
+		return nil, errors.Errorf("subscribe: unexpected content type %q", contentType)
+	}
+	return resp, nil
+}
+
+// readSSE delivers the results of an event stream until the server
+// completes the subscription or ctx is done. A stream that ends early is
+// sent again following the retry policy of the client.
+func (c *clientImp) readSSE(ctx context.Context, req *Request, payload json.RawMessage, resp *http.Response, results chan<- Result) {
+	defer close(results)
+	deliver := func(result Result) bool {
+		select {
+		case results <- result:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		var limitErr *ResponseLimitError
+		completed, err := readEvents(resp.Body, c.maxResponseSize, func(event, data string) bool {
+			c.logf("<< %s %s", event, data)
+			if event != "next" {
+				return true
+			}
+			if c.maxResponseDepth > 0 {
+				reader := c.limitBody(strings.NewReader(data))
+				io.Copy(ioutil.Discard, reader)
+				if limitErr = reader.err; limitErr != nil {
+					return false
+				}
+			}
+			return deliver(c.newResult(json.RawMessage(data)))
+		})
+		resp.Body.Close()
+		if errLimit, ok := err.(*ResponseLimitError); ok {
+			limitErr = errLimit
+		}
+		if limitErr != nil {
+			// the same event would come again after reconnecting
+			deliver(Result{Err: limitErr})
+			return
+		}
+		if completed || ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		c.logf("(subscription) stream lost: %s", err)
+		resp, err = c.resubscribeSSE(ctx, req, payload)
+		if err != nil {
+			if ctx.Err() == nil {
+				deliver(Result{Err: errors.Wrap(err, "stream lost")})
+			}
+			return
+		}
+		if !deliver(Result{Reconnected: true}) {
+			resp.Body.Close()
+			return
+		}
+	}
+}
+
+// resubscribeSSE sends a subscription whose stream ended early again,
+// following the retry policy of the client.
+func (c *clientImp) resubscribeSSE(ctx context.Context, req *Request, payload json.RawMessage) (*http.Response, error) {
+	retryConfig := c.retryConfig
+	if retryConfig.Policy == "" {
+		return nil, errors.New("no retry policy")
+	}
+	var err error
+	for tryCount := 0; tryCount < retryConfig.MaxTries; tryCount++ {
+		timer := time.NewTimer(time.Duration(retryConfig.Interval) * time.Second)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		retryConfig.increaseInterval()
+
+		c.logf("(subscription) [%d] reconnecting", tryCount)
+		var resp *http.Response
+		resp, err = c.postSSE(ctx, req, payload)
+		if err == nil {
+			return resp, nil
+		}
+		c.logf("(subscription) [%d] reconnect failed: %s", tryCount, err)
+	}
+	return nil, errors.Wrapf(err, "reconnect failed after %d tries", retryConfig.MaxTries)
+}
+
+// readEvents reads Server-Sent Events from r and passes them to handle
+// until handle returns false, the stream ends, or a complete event is read,
+// in which case it reports true. Events whose data is larger than maxSize
+// bytes, if set, fail with a *ResponseLimitError.
+func readEvents(r io.Reader, maxSize int64, handle func(event, data string) bool) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	maxLine := 16 * 1024 * 1024
+	if maxSize > 0 && maxSize < int64(maxLine) {
+		// room for the field name and the line ending
+		maxLine = int(maxSize) + len("data: \r\n")
+	}
+	scanner.Buffer(make([]byte, 0, 4096), maxLine+1)
+	scanner.Split(func(b []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(b, atEOF)
+		if token == nil && err == nil && len(b) > maxLine && maxSize > 0 {
+			return 0, nil, &ResponseLimitError{MaxSize: maxSize, Body: eventSnippet(b)}
+		}
+		return advance, token, err
+	})
+	var event string
+	var data []string
+	var size int
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 || event != "" {
+				if event == "complete" {
+					return true, nil
+				}
+				if event == "" {
+					event = "message"
+				}
+				if !handle(event, strings.Join(data, "\n")) {
+					return false, nil
+				}
+			}
+			event, data, size = "", nil, 0
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment, used as a keep-alive
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+			if size += len(value) + 1; maxSize > 0 && int64(size-1) > maxSize {
+				body := strings.Join(data, "\n")
+				return false, &ResponseLimitError{MaxSize: maxSize, Body: eventSnippet([]byte(body))}
+			}
+		}
+	}
+	return false, scanner.Err()
+}
+
+// eventSnippet returns the start of the data of an event, for errors.
+func eventSnippet(b []byte) []byte {
+	b = bytes.TrimPrefix(b, []byte("data:"))
+	b = bytes.TrimPrefix(b, []byte(" "))
+	if len(b) > bodySnippetSize {
+		b = b[:bodySnippetSize]
+	}
+	return append([]byte(nil), b...)
+}
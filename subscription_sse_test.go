@@ -0,0 +1,111 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestSubscribeSSE(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Method, http.MethodPost)
+		is.Equal(r.Header.Get("Accept"), "text/event-stream")
+		is.Equal(r.Header.Get("Authorization"), "Bearer token")
+		is.Equal(r.Header.Get("X-Custom-Header"), "123")
+		var op batchOperation
+		is.NoErr(json.NewDecoder(r.Body).Decode(&op))
+		is.Equal(op.Query, "subscription ($id: ID!) { jobStatus(id: $id) }")
+		is.Equal(op.Variables["id"], "job")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ":\n\n")
+		fmt.Fprint(w, "event: next\ndata: {\"data\":{\"jobStatus\":\"running\"}}\n\n")
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, "event: next\ndata: {\"data\":null,\n")
+		fmt.Fprint(w, "data: \"errors\":[{\"message\":\"no job\"}]}\n\n")
+		fmt.Fprint(w, "event: complete\ndata:\n\n")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL,
+		WithSubscriptionProtocols(GraphQLSSE),
+		WithDefaultHeaders(map[string]string{"Authorization": "Bearer token"}))
+
+	req := NewRequest("subscription ($id: ID!) { jobStatus(id: $id) }")
+	req.Var("id", "job")
+	req.Header.Set("X-Custom-Header", "123")
+	results, err := client.Subscribe(ctx, req)
+	is.NoErr(err)
+
+	var got []Result
+	for result := range results {
+		got = append(got, result)
+	}
+	is.Equal(len(got), 2)
+	is.NoErr(got[0].Err)
+	is.Equal(string(got[0].Data), `{"jobStatus":"running"}`)
+	is.True(strings.Contains(got[1].Err.Error(), "no job"))
+}
+
+func TestSubscribeSSENotAStream(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"errors":[{"message":"bad subscription"}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithSubscriptionProtocols(GraphQLSSE))
+	_, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "bad subscription"))
+}
+
+func TestSubscribeSSEReconnect(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: next\ndata: {\"data\":{\"request\":%d}}\n\n", n)
+		if n == 2 {
+			fmt.Fprint(w, "event: complete\n\n")
+		}
+		// the first stream ends without completing
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTestDuration(2))
+	defer cancel()
+	retryConfig := RetryConfig{
+		MaxTries: 2,
+		Interval: 1,
+		Policy:   Linear,
+	}
+	client := NewClient(srv.URL, WithSubscriptionProtocols(GraphQLSSE), WithRetryConfig(retryConfig))
+	results, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+
+	var got []Result
+	for result := range results {
+		got = append(got, result)
+	}
+	is.Equal(len(got), 3)
+	is.Equal(string(got[0].Data), `{"request":1}`)
+	is.True(got[1].Reconnected)
+	is.Equal(string(got[2].Data), `{"request":2}`)
+}
@@ -0,0 +1,664 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// Message types shared by both WebSocket protocols.
+const (
+	wsConnectionInit = "connection_init"
+	wsConnectionAck  = "connection_ack"
+	wsError          = "error"
+	wsComplete       = "complete"
+
+	wsAckTimeout = 10 * time.Second
+)
+
+// wsProtocol holds the message types of a WebSocket subscription protocol
+// that differ between protocols. Empty types are not part of the protocol.
+type wsProtocol struct {
+	subscribe string
+	next      string
+	// stop is sent by the client to end a subscription.
+	stop string
+	ping string
+	pong string
+	// keepAlive is sent by the server and needs no answer.
+	keepAlive string
+	// connectionError is sent by the server to reject connection_init.
+	connectionError string
+	// terminate is sent by the client before closing the connection.
+	terminate string
+}
+
+var wsProtocols = map[SubscriptionProtocol]*wsProtocol{
+	GraphQLTransportWS: {
+		subscribe: "subscribe",
+		next:      "next",
+		stop:      wsComplete,
+		ping:      "ping",
+		pong:      "pong",
+	},
+	SubscriptionsTransportWS: {
+		subscribe:       "start",
+		next:            "data",
+		stop:            "stop",
+		keepAlive:       "ka",
+		connectionError: "connection_error",
+		terminate:       "connection_terminate",
+	},
+}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Subscribe starts a subscription over a WebSocket, or over Server-Sent
+// Events if GraphQLSSE is the preferred protocol, and delivers its results
+// on the returned channel. The protocol is negotiated with the server among
+// the protocols set with WithSubscriptionProtocols. The default headers of
+// the client are sent as the connection_init payload, the request headers
+// with the WebSocket handshake. The channel is closed when the server
+// completes the subscription, after an error, or once ctx is done.
+//
+// Subscriptions with the same request headers share a single connection,
+// which is opened by the first of them and closed once the last one has
+// been idle for the timeout set with WithSubscriptionIdleTimeout. Results
+// are buffered per subscription; a subscription whose consumer falls behind
+// by more than the buffer set with WithSubscriptionBufferSize is ended with
+// ErrSlowConsumer, so it does not hold up the others.
+//
+// Over Server-Sent Events, each subscription is a request of its own to the
+// endpoint of the client, sent with its default and request headers through
+// its HTTP client, which must not have a timeout shorter than the
+// subscription.
+//
+// If the client has a retry policy, a dropped connection is re-established
+// following it and the subscription is started again; a Result with
+// Reconnected set is delivered once it is.
+func (c *clientImp) Subscribe(ctx context.Context, req *Request) (<-chan Result, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if len(req.files) > 0 || hasUploadVars(req) {
+		return nil, errors.New("cannot send files with a subscription")
+	}
+	payload, err := c.codec.Marshal(batchOperation{Query: req.q, Variables: req.vars})
+	if err != nil {
+		return nil, errors.Wrap(err, "encode body")
+	}
+	if c.subscriptionProtocols[0] == GraphQLSSE {
+		return c.subscribeSSE(ctx, req, payload)
+	}
+	for {
+		conn, err := c.webSocket(ctx, req.Header)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := conn.subscribe(ctx, payload)
+		if err == errWSClosed {
+			// closed while idle, open a new one
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.logf(">> subscribe: %s", req.q)
+		return sub.results, nil
+	}
+}
+
+var errWSClosed = errors.New("connection closed")
+
+// wsConn is a WebSocket connection running subscriptions. It is
+// re-established when it drops, as long as it has subscriptions.
+type wsConn struct {
+	client *clientImp
+	// key identifies the connection in the pool of the client.
+	key    string
+	header http.Header
+
+	writeMu sync.Mutex
+
+	mu     sync.Mutex
+	ws     *websocket.Conn
+	proto  *wsProtocol
+	subs   map[string]*wsSubscription
+	nextID int
+	// idle closes the connection once it has no subscriptions.
+	idle *time.Timer
+	// stopPing stops pinging the current socket.
+	stopPing chan struct{}
+	closed   chan struct{}
+}
+
+// wsSubscription is a subscription running on a wsConn.
+type wsSubscription struct {
+	id      string
+	payload json.RawMessage
+	ctx     context.Context
+	// queue is written by the reader of the connection and closed when the
+	// subscription ends, after setting err. pump forwards it to results.
+	queue   chan Result
+	err     error
+	results chan Result
+	// done is closed once pump returns.
+	done chan struct{}
+}
+
+// pump forwards the results of the subscription to its consumer until the
+// subscription ends or its context is done.
+func (s *wsSubscription) pump() {
+	defer close(s.done)
+	defer close(s.results)
+	for {
+		select {
+		case result, ok := <-s.queue:
+			if !ok {
+				if s.err == nil {
+					return
+				}
+				result = Result{Err: s.err}
+			}
+			select {
+			case s.results <- result:
+			case <-s.ctx.Done():
+				return
+			}
+			if !ok {
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver queues result without blocking. It reports false if the queue is
+// full.
+func (s *wsSubscription) deliver(result Result) bool {
+	select {
+	case s.queue <- result:
+		return true
+	default:
+		return false
+	}
+}
+
+// finish ends the subscription with err, which is nil if the server
+// completed it.
+func (s *wsSubscription) finish(err error) {
+	s.err = err
+	close(s.queue)
+}
+
+// webSocket returns the connection of the client for header, opening it
+// if there is none.
+func (c *clientImp) webSocket(ctx context.Context, header http.Header) (*wsConn, error) {
+	key := headerKey(header)
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+	if conn, ok := c.wsConns[key]; ok && !conn.isClosed() {
+		return conn, nil
+	}
+	conn := &wsConn{
+		client: c,
+		key:    key,
+		header: header,
+		subs:   make(map[string]*wsSubscription),
+		closed: make(chan struct{}),
+	}
+	if _, err := conn.connect(ctx); err != nil {
+		return nil, err
+	}
+	go conn.run()
+	if c.wsConns == nil {
+		c.wsConns = make(map[string]*wsConn)
+	}
+	c.wsConns[key] = conn
+	return conn, nil
+}
+
+// forgetWebSocket removes a closed connection from the pool of the client.
+func (c *clientImp) forgetWebSocket(conn *wsConn) {
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+	if c.wsConns[conn.key] == conn {
+		delete(c.wsConns, conn.key)
+	}
+}
+
+// connect opens the WebSocket, waits for the server to acknowledge the
+// connection and starts the subscriptions of the connection on it, which
+// it returns.
+func (conn *wsConn) connect(ctx context.Context) ([]*wsSubscription, error) {
+	c := conn.client
+	endpoint := c.subscriptionEndpoint
+	if endpoint == "" {
+		endpoint = websocketURL(c.endpoint)
+	}
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: wsAckTimeout,
+	}
+	for _, protocol := range c.subscriptionProtocols {
+		if _, ok := wsProtocols[protocol]; ok {
+			dialer.Subprotocols = append(dialer.Subprotocols, string(protocol))
+		}
+	}
+	if len(dialer.Subprotocols) == 0 {
+		return nil, errors.New("no WebSocket subscription protocol enabled")
+	}
+	transport, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok && c.httpClient.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if ok {
+		dialer.Proxy = transport.Proxy
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+	requestHeader := make(http.Header)
+	for key, values := range conn.header {
+		requestHeader[key] = append([]string(nil), values...)
+	}
+	c.logf(">> dial: %s", endpoint)
+	ws, resp, err := dialer.DialContext(ctx, endpoint, requestHeader)
+	if err != nil {
+		if resp != nil {
+			return nil, errors.Wrapf(err, "dial %s: status %d", endpoint, resp.StatusCode)
+		}
+		return nil, errors.Wrapf(err, "dial %s", endpoint)
+	}
+	if c.maxResponseSize > 0 {
+		ws.SetReadLimit(c.maxResponseSize)
+	}
+
+	// servers that ignore the subprotocol header get our first choice
+	protocol := SubscriptionProtocol(ws.Subprotocol())
+	if protocol == "" {
+		protocol = SubscriptionProtocol(dialer.Subprotocols[0])
+	}
+	proto, ok := wsProtocols[protocol]
+	if !ok {
+		ws.Close()
+		return nil, errors.Errorf("server selected unsupported protocol %q", protocol)
+	}
+	c.logf(">> protocol: %s", protocol)
+
+	// a map of strings always encodes
+	payload, _ := c.codec.Marshal(c.defaultHeaders)
+	if len(c.defaultHeaders) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	if err := ws.WriteJSON(wsMessage{Type: wsConnectionInit, Payload: payload}); err != nil {
+		ws.Close()
+		return nil, errors.Wrap(err, "connection init")
+	}
+	deadline := time.Now().Add(wsAckTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	ws.SetReadDeadline(deadline)
+	for {
+		var ack wsMessage
+		if err := conn.read(ws, &ack); err != nil {
+			ws.Close()
+			return nil, errors.Wrap(err, "waiting for connection ack")
+		}
+		if ack.Type == wsConnectionAck {
+			break
+		}
+		if ack.Type == proto.keepAlive {
+			continue
+		}
+		ws.Close()
+		if ack.Type == proto.connectionError {
+			return nil, errors.Errorf("connection rejected: %s", ack.Payload)
+		}
+		return nil, errors.Errorf("expected %s but got %s", wsConnectionAck, ack.Type)
+	}
+	ws.SetReadDeadline(time.Time{})
+
+	// Subscriptions are started on the socket before anything else can
+	// write to it, so none of them is started twice or missed.
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.isClosed() {
+		ws.Close()
+		return nil, errWSClosed
+	}
+	subs := make([]*wsSubscription, 0, len(conn.subs))
+	for _, sub := range conn.subs {
+		if err := conn.writeTo(ws, wsMessage{ID: sub.id, Type: proto.subscribe, Payload: sub.payload}); err != nil {
+			ws.Close()
+			return nil, errors.Wrap(err, "subscribe")
+		}
+		subs = append(subs, sub)
+	}
+	conn.ws = ws
+	conn.proto = proto
+	if c.subscriptionKeepAlive > 0 && proto.ping != "" {
+		conn.stopPing = make(chan struct{})
+		go conn.ping(ws, proto, conn.stopPing)
+	}
+	return subs, nil
+}
+
+// ping keeps the server sending pongs, so a dead socket is noticed by the
+// keep-alive timeout.
+func (conn *wsConn) ping(ws *websocket.Conn, proto *wsProtocol, stop chan struct{}) {
+	ticker := time.NewTicker(conn.client.subscriptionKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			conn.writeTo(ws, wsMessage{Type: proto.ping})
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (conn *wsConn) write(msg wsMessage) error {
+	conn.mu.Lock()
+	ws := conn.ws
+	conn.mu.Unlock()
+	return conn.writeTo(ws, msg)
+}
+
+func (conn *wsConn) writeTo(ws *websocket.Conn, msg wsMessage) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	return ws.WriteJSON(msg)
+}
+
+// subscribe starts a subscription on the connection. It returns errWSClosed
+// if the connection was closed for being idle.
+func (conn *wsConn) subscribe(ctx context.Context, payload json.RawMessage) (*wsSubscription, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.isClosed() {
+		return nil, errWSClosed
+	}
+	if conn.idle != nil {
+		conn.idle.Stop()
+		conn.idle = nil
+	}
+	conn.nextID++
+	sub := &wsSubscription{
+		id:      strconv.Itoa(conn.nextID),
+		payload: payload,
+		ctx:     ctx,
+		queue:   make(chan Result, conn.client.subscriptionBufferSize),
+		results: make(chan Result),
+		done:    make(chan struct{}),
+	}
+	conn.subs[sub.id] = sub
+	if err := conn.writeTo(conn.ws, wsMessage{ID: sub.id, Type: conn.proto.subscribe, Payload: payload}); err != nil {
+		// the connection dropped: the subscription is started again once
+		// it is re-established, or ended with the error that closes it
+		conn.client.logf("(subscription) subscribe: %s", err)
+	}
+	go sub.pump()
+	go func() {
+		<-sub.done
+		conn.unsubscribe(sub)
+	}()
+	return sub, nil
+}
+
+// unsubscribe removes a subscription once its consumer is gone, stopping it
+// on the server if it is still running.
+func (conn *wsConn) unsubscribe(sub *wsSubscription) {
+	conn.mu.Lock()
+	_, active := conn.subs[sub.id]
+	delete(conn.subs, sub.id)
+	proto := conn.proto
+	conn.mu.Unlock()
+	if active {
+		conn.write(wsMessage{ID: sub.id, Type: proto.stop})
+	}
+	conn.closeIfIdle()
+}
+
+// closeIfIdle closes the connection after the idle timeout of the client if
+// it has no subscriptions.
+func (conn *wsConn) closeIfIdle() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if len(conn.subs) > 0 || conn.idle != nil || conn.isClosed() {
+		return
+	}
+	conn.idle = time.AfterFunc(conn.client.subscriptionIdleTimeout, func() {
+		conn.mu.Lock()
+		if len(conn.subs) > 0 {
+			// a subscription came in while the timer fired
+			conn.mu.Unlock()
+			return
+		}
+		conn.idle = nil
+		conn.closeLocked()
+		conn.mu.Unlock()
+		conn.client.forgetWebSocket(conn)
+	})
+}
+
+// close closes the connection for good.
+func (conn *wsConn) close() {
+	conn.mu.Lock()
+	conn.closeLocked()
+	conn.mu.Unlock()
+	conn.client.forgetWebSocket(conn)
+}
+
+// closeLocked closes the connection with conn.mu held.
+func (conn *wsConn) closeLocked() {
+	if conn.isClosed() {
+		return
+	}
+	close(conn.closed)
+	if conn.idle != nil {
+		conn.idle.Stop()
+		conn.idle = nil
+	}
+	if conn.stopPing != nil {
+		close(conn.stopPing)
+		conn.stopPing = nil
+	}
+	if conn.proto.terminate != "" {
+		conn.writeTo(conn.ws, wsMessage{Type: conn.proto.terminate})
+	}
+	conn.ws.Close()
+}
+
+func (conn *wsConn) isClosed() bool {
+	select {
+	case <-conn.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// run reads the messages of the connection and dispatches them to the
+// subscriptions, reconnecting when the connection drops. It is the only
+// writer of the queues of the subscriptions.
+func (conn *wsConn) run() {
+	for {
+		conn.mu.Lock()
+		ws := conn.ws
+		conn.mu.Unlock()
+		if keepAlive := conn.client.subscriptionKeepAlive; keepAlive > 0 {
+			ws.SetReadDeadline(time.Now().Add(keepAlive))
+		}
+		var msg wsMessage
+		if err := conn.read(ws, &msg); err != nil {
+			if conn.isClosed() {
+				return
+			}
+			if limitErr, ok := err.(*ResponseLimitError); ok {
+				// the same message would come again after reconnecting
+				conn.fail(limitErr)
+				return
+			}
+			conn.client.logf("(subscription) connection lost: %s", err)
+			if errReconnect := conn.reconnect(); errReconnect != nil {
+				conn.fail(errors.Wrapf(errReconnect, "connection lost: %s", err))
+				return
+			}
+			continue
+		}
+		conn.client.logf("<< %s %s", msg.Type, msg.Payload)
+		conn.dispatch(msg)
+	}
+}
+
+// read reads the next message of ws, failing with a *ResponseLimitError if
+// it goes over the limits of the client.
+func (conn *wsConn) read(ws *websocket.Conn, msg *wsMessage) error {
+	_, r, err := ws.NextReader()
+	if err == nil {
+		reader := conn.client.limitBody(r)
+		err = json.NewDecoder(reader).Decode(msg)
+		if reader.err != nil {
+			return reader.err
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err == websocket.ErrReadLimit {
+		return &ResponseLimitError{MaxSize: conn.client.maxResponseSize}
+	}
+	return err
+}
+
+func (conn *wsConn) dispatch(msg wsMessage) {
+	conn.mu.Lock()
+	proto := conn.proto
+	sub := conn.subs[msg.ID]
+	conn.mu.Unlock()
+	switch msg.Type {
+	case "":
+	case proto.ping:
+		conn.write(wsMessage{Type: proto.pong})
+	case proto.pong, proto.keepAlive:
+	case proto.next:
+		if sub != nil {
+			conn.deliver(sub, conn.client.newResult(msg.Payload))
+		}
+	case wsError:
+		if sub != nil {
+			conn.end(sub, decodeErrorPayload(msg.Payload))
+		}
+	case wsComplete:
+		if sub != nil {
+			conn.end(sub, nil)
+		}
+	}
+}
+
+// deliver queues result for sub, stopping sub with ErrSlowConsumer if its
+// consumer has fallen too far behind.
+func (conn *wsConn) deliver(sub *wsSubscription, result Result) {
+	if sub.deliver(result) {
+		return
+	}
+	conn.client.logf("(subscription) %s: %s", sub.id, ErrSlowConsumer)
+	conn.mu.Lock()
+	proto := conn.proto
+	conn.mu.Unlock()
+	conn.write(wsMessage{ID: sub.id, Type: proto.stop})
+	conn.end(sub, ErrSlowConsumer)
+}
+
+// end removes a subscription that is over, ending it with err.
+func (conn *wsConn) end(sub *wsSubscription, err error) {
+	conn.mu.Lock()
+	delete(conn.subs, sub.id)
+	conn.mu.Unlock()
+	sub.finish(err)
+	conn.closeIfIdle()
+}
+
+// fail ends every subscription with err and closes the connection.
+func (conn *wsConn) fail(err error) {
+	conn.mu.Lock()
+	subs := conn.subs
+	conn.subs = make(map[string]*wsSubscription)
+	conn.mu.Unlock()
+	for _, sub := range subs {
+		sub.finish(err)
+	}
+	conn.close()
+}
+
+// reconnect re-establishes a dropped connection following the retry policy
+// of the client and starts its subscriptions again.
+func (conn *wsConn) reconnect() error {
+	retryConfig := conn.client.retryConfig
+	if retryConfig.Policy == "" {
+		return errors.New("no retry policy")
+	}
+	conn.mu.Lock()
+	if conn.stopPing != nil {
+		close(conn.stopPing)
+		conn.stopPing = nil
+	}
+	conn.ws.Close()
+	conn.mu.Unlock()
+
+	var err error
+	for tryCount := 0; tryCount < retryConfig.MaxTries; tryCount++ {
+		timer := time.NewTimer(time.Duration(retryConfig.Interval) * time.Second)
+		select {
+		case <-conn.closed:
+			timer.Stop()
+			return errors.New("connection closed")
+		case <-timer.C:
+		}
+		retryConfig.increaseInterval()
+
+		conn.client.logf("(subscription) [%d] reconnecting", tryCount)
+		ctx, cancel := context.WithTimeout(context.Background(), wsAckTimeout)
+		var subs []*wsSubscription
+		subs, err = conn.connect(ctx)
+		cancel()
+		if err != nil {
+			conn.client.logf("(subscription) [%d] reconnect failed: %s", tryCount, err)
+			continue
+		}
+		for _, sub := range subs {
+			conn.deliver(sub, Result{Reconnected: true})
+		}
+		return nil
+	}
+	return errors.Wrapf(err, "reconnect failed after %d tries", retryConfig.MaxTries)
+}
+
+// decodeErrorPayload decodes the payload of an error message: a list of
+// GraphQL errors, or a single error in the legacy protocol.
+func decodeErrorPayload(payload json.RawMessage) error {
+	var errs []GraphQLError
+	if err := json.Unmarshal(payload, &errs); err != nil {
+		var single GraphQLError
+		if errSingle := json.Unmarshal(payload, &single); errSingle != nil {
+			return errors.Wrap(err, "decode error message")
+		}
+		errs = []GraphQLError{single}
+	}
+	return getAggrErr(errs)
+}
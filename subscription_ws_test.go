@@ -0,0 +1,417 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/matryer/is"
+)
+
+func TestSubscribe(t *testing.T) {
+	is := is.New(t)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("X-Custom-Header"), "123")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		is.Equal(conn.Subprotocol(), "graphql-transport-ws")
+
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg.Type, "connection_init")
+		is.Equal(string(msg.Payload), `{"Authorization":"Bearer token"}`)
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_ack"}))
+
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg.Type, "subscribe")
+		var op batchOperation
+		is.NoErr(json.Unmarshal(msg.Payload, &op))
+		is.Equal(op.Query, "subscription ($id: ID!) { jobStatus(id: $id) }")
+		is.Equal(op.Variables["id"], "job")
+		id := msg.ID
+
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "ping"}))
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg.Type, "pong")
+
+		is.NoErr(conn.WriteJSON(wsMessage{ID: id, Type: "next", Payload: json.RawMessage(`{"data":{"jobStatus":"running"}}`)}))
+		is.NoErr(conn.WriteJSON(wsMessage{ID: id, Type: "next", Payload: json.RawMessage(`{"data":null,"errors":[{"name":"not_found","message":"no job"}]}`)}))
+		is.NoErr(conn.WriteJSON(wsMessage{ID: id, Type: "complete"}))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithDefaultHeaders(map[string]string{"Authorization": "Bearer token"}))
+
+	req := NewRequest("subscription ($id: ID!) { jobStatus(id: $id) }")
+	req.Var("id", "job")
+	req.Header.Set("X-Custom-Header", "123")
+	results, err := client.Subscribe(ctx, req)
+	is.NoErr(err)
+
+	var got []Result
+	for result := range results {
+		got = append(got, result)
+	}
+	is.Equal(len(got), 2)
+	is.NoErr(got[0].Err)
+	var data struct {
+		JobStatus string
+	}
+	is.NoErr(got[0].Decode(&data))
+	is.Equal(data.JobStatus, "running")
+	is.True(strings.Contains(got[1].Err.Error(), "no job"))
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	is := is.New(t)
+	completed := make(chan string, 1)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_ack"}))
+		is.NoErr(conn.ReadJSON(&msg))
+		id := msg.ID
+		is.NoErr(conn.WriteJSON(wsMessage{ID: id, Type: "next", Payload: json.RawMessage(`{"data":{}}`)}))
+		for conn.ReadJSON(&msg) == nil {
+			if msg.Type == "complete" {
+				completed <- msg.ID
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewClient(srv.URL)
+	results, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+	<-results
+	cancel()
+	for range results {
+	}
+	select {
+	case id := <-completed:
+		is.True(id != "")
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not completed")
+	}
+}
+
+func TestSubscribeLegacyProtocol(t *testing.T) {
+	is := is.New(t)
+	stopped := make(chan string, 1)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		is.Equal(conn.Subprotocol(), "graphql-ws")
+
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg.Type, "connection_init")
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "ka"}))
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_ack"}))
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "ka"}))
+
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg.Type, "start")
+		id := msg.ID
+		is.NoErr(conn.WriteJSON(wsMessage{ID: id, Type: "data", Payload: json.RawMessage(`{"data":{"jobStatus":"running"}}`)}))
+		for conn.ReadJSON(&msg) == nil {
+			if msg.Type == "stop" {
+				stopped <- msg.ID
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewClient(srv.URL)
+	results, err := client.Subscribe(ctx, NewRequest("subscription { jobStatus }"))
+	is.NoErr(err)
+
+	result := <-results
+	is.NoErr(result.Err)
+	is.Equal(string(result.Data), `{"jobStatus":"running"}`)
+	cancel()
+	for range results {
+	}
+	select {
+	case id := <-stopped:
+		is.True(id != "")
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not stopped")
+	}
+}
+
+func TestSubscribeProtocolMismatch(t *testing.T) {
+	is := is.New(t)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("Sec-Websocket-Protocol"), "graphql-transport-ws")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_error", Payload: json.RawMessage(`{"message":"unsupported"}`)}))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithSubscriptionProtocols(GraphQLTransportWS))
+	_, err := client.Subscribe(ctx, NewRequest("subscription { jobStatus }"))
+	is.True(err != nil)
+}
+
+func TestSubscribeUploads(t *testing.T) {
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	for _, protocol := range []SubscriptionProtocol{GraphQLTransportWS, GraphQLSSE} {
+		client := NewClient(srv.URL, UseMultipartRequestSpec(), WithSubscriptionProtocols(protocol))
+		req := NewRequest("subscription ($f: Upload!) { progress(file: $f) }")
+		req.Var("f", Upload{Name: "f.txt", R: strings.NewReader("contents")})
+		_, err := client.Subscribe(ctx, req)
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), "cannot send files"))
+	}
+	is.Equal(atomic.LoadInt32(&calls), int32(0)) // not sent as null
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	var connections int32
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&connections, 1)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg.Type, "connection_init")
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_ack"}))
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg.Type, "subscribe")
+		is.Equal(msg.ID, "1")
+		payload := json.RawMessage(fmt.Sprintf(`{"data":{"connection":%d}}`, n))
+		is.NoErr(conn.WriteJSON(wsMessage{ID: msg.ID, Type: "next", Payload: payload}))
+		if n == 2 {
+			is.NoErr(conn.WriteJSON(wsMessage{ID: msg.ID, Type: "complete"}))
+		}
+		// the first connection is dropped by returning
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTestDuration(2))
+	defer cancel()
+	retryConfig := RetryConfig{
+		MaxTries: 2,
+		Interval: 1,
+		Policy:   Linear,
+	}
+	client := NewClient(srv.URL, WithRetryConfig(retryConfig))
+	results, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+
+	var got []Result
+	for result := range results {
+		got = append(got, result)
+	}
+	is.Equal(len(got), 3)
+	is.Equal(string(got[0].Data), `{"connection":1}`)
+	is.True(got[1].Reconnected)
+	is.Equal(string(got[2].Data), `{"connection":2}`)
+}
+
+func TestSubscribeKeepAliveTimeout(t *testing.T) {
+	is := is.New(t)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_ack"}))
+		// never answer pings
+		for conn.ReadJSON(&msg) == nil {
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithSubscriptionKeepAlive(100*time.Millisecond))
+	results, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+
+	result, ok := <-results
+	is.True(ok)
+	is.True(result.Err != nil)
+	is.True(ctx.Err() == nil) // ended by the keep-alive timeout
+	_, ok = <-results
+	is.True(!ok)
+}
+
+// newSubscriptionServer starts a graphql-transport-ws server that answers
+// each subscription with results, then completes it if complete is set. It
+// counts the connections made to it and signals closed when one is closed.
+func newSubscriptionServer(t *testing.T, results func(id string) []string, complete bool) (*httptest.Server, *int32, chan struct{}) {
+	is := is.New(t)
+	var connections int32
+	closed := make(chan struct{}, 10)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&connections, 1)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_ack"}))
+		for conn.ReadJSON(&msg) == nil {
+			if msg.Type != "subscribe" {
+				continue
+			}
+			for _, data := range results(msg.ID) {
+				is.NoErr(conn.WriteJSON(wsMessage{ID: msg.ID, Type: "next", Payload: json.RawMessage(`{"data":` + data + `}`)}))
+			}
+			if complete {
+				is.NoErr(conn.WriteJSON(wsMessage{ID: msg.ID, Type: "complete"}))
+			}
+		}
+		closed <- struct{}{}
+	}))
+	return srv, &connections, closed
+}
+
+func TestSubscribeSharedConnection(t *testing.T) {
+	is := is.New(t)
+	srv, connections, _ := newSubscriptionServer(t, func(id string) []string {
+		return []string{fmt.Sprintf(`{"id":%q}`, id)}
+	}, false)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithSubscriptionIdleTimeout(0))
+	first, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+	second, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+
+	is.Equal(string((<-first).Data), `{"id":"1"}`)
+	is.Equal(string((<-second).Data), `{"id":"2"}`)
+	is.Equal(atomic.LoadInt32(connections), int32(1))
+
+	// other headers get their own connection
+	req := NewRequest("subscription { changed }")
+	req.Header.Set("Authorization", "Bearer other")
+	third, err := client.Subscribe(ctx, req)
+	is.NoErr(err)
+	is.Equal(string((<-third).Data), `{"id":"1"}`)
+	is.Equal(atomic.LoadInt32(connections), int32(2))
+}
+
+func TestSubscribeSlowConsumer(t *testing.T) {
+	is := is.New(t)
+	var connections int32
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&connections, 1)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg wsMessage
+		is.NoErr(conn.ReadJSON(&msg))
+		is.NoErr(conn.WriteJSON(wsMessage{Type: "connection_ack"}))
+		for conn.ReadJSON(&msg) == nil {
+			if msg.Type != "subscribe" || msg.ID != "2" {
+				continue
+			}
+			// both subscriptions are on the socket: flood the first one,
+			// then send the second one its result
+			for i := 1; i <= 5; i++ {
+				is.NoErr(conn.WriteJSON(wsMessage{ID: "1", Type: "next", Payload: json.RawMessage(fmt.Sprintf(`{"data":%d}`, i))}))
+			}
+			is.NoErr(conn.WriteJSON(wsMessage{ID: "2", Type: "next", Payload: json.RawMessage(`{"data":1}`)}))
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithSubscriptionBufferSize(1), WithSubscriptionIdleTimeout(time.Minute))
+	slow, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+	fast, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+	is.NoErr(err)
+
+	// the slow subscription does not hold up the other one on the socket
+	result := <-fast
+	is.NoErr(result.Err)
+	is.Equal(string(result.Data), "1")
+	is.Equal(atomic.LoadInt32(&connections), int32(1))
+
+	var got []Result
+	for result := range slow {
+		got = append(got, result)
+	}
+	is.True(len(got) > 0)
+	is.True(len(got) < 5)
+	is.Equal(got[len(got)-1].Err, ErrSlowConsumer)
+}
+
+func TestSubscribeIdleClose(t *testing.T) {
+	is := is.New(t)
+	srv, connections, closed := newSubscriptionServer(t, func(id string) []string {
+		return []string{"{}"}
+	}, true)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithSubscriptionIdleTimeout(100*time.Millisecond))
+	subscribe := func() {
+		results, err := client.Subscribe(ctx, NewRequest("subscription { changed }"))
+		is.NoErr(err)
+		for range results {
+		}
+	}
+	subscribe()
+	subscribe()
+	is.Equal(atomic.LoadInt32(connections), int32(1)) // reused while idle
+
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		t.Fatal("idle connection was not closed")
+	}
+	subscribe()
+	is.Equal(atomic.LoadInt32(connections), int32(2))
+}
@@ -0,0 +1,190 @@
+package graphql
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Upload is a file set as a variable with Request.Var, anywhere in its
+// value, including inside lists and input objects. It is sent following the
+// GraphQL multipart request spec by a Client created with the
+// UseMultipartRequestSpec option. Other clients fail to run requests with
+// uploads rather than send them as null.
+//
+//	req.Var("file", graphql.Upload{Name: "photo.jpg", R: photo})
+//	req.Var("files", []*graphql.Upload{{Name: "a.txt", R: a}, {Name: "b.txt", R: b}})
+//
+// The same *Upload set at several places is sent once. Field is unused.
+type Upload File
+
+// MarshalJSON encodes the upload as the null placeholder of the spec.
+func (Upload) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// UseMultipartRequestSpec sends requests with files following the GraphQL
+// multipart request spec: an operations field holding the query and the
+// variables, with null in place of each file, a map field telling where
+// each file goes in the variables, then the files. Files are set as Upload
+// variables, or with Request.File, in which case the field name of the file
+// is its path in the operations field, such as variables.file. Requests
+// without files are sent as JSON.
+func UseMultipartRequestSpec() ClientOption {
+	return func(client *clientImp) {
+		client.useMultipartSpec = true
+	}
+}
+
+// upload is a file to send and the paths it is mapped to.
+type upload struct {
+	file  File
+	paths []string
+}
+
+// requestUploads returns the files of req, those set as variables first.
+func requestUploads(req *Request) []*upload {
+	var uploads []*upload
+	seen := make(map[*Upload]*upload)
+	keys := make([]string, 0, len(req.vars))
+	for key := range req.vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		findUploads(reflect.ValueOf(req.vars[key]), "variables."+key, func(path string, u *Upload, shared bool) {
+			if shared {
+				if found, ok := seen[u]; ok {
+					found.paths = append(found.paths, path)
+					return
+				}
+			}
+			found := &upload{file: File(*u), paths: []string{path}}
+			if shared {
+				seen[u] = found
+			}
+			uploads = append(uploads, found)
+		})
+	}
+	for _, file := range req.files {
+		uploads = append(uploads, &upload{file: file, paths: []string{file.Field}})
+	}
+	return uploads
+}
+
+// hasUploadVars reports whether an Upload is set in the variables of req.
+func hasUploadVars(req *Request) bool {
+	found := false
+	for _, value := range req.vars {
+		findUploads(reflect.ValueOf(value), "", func(string, *Upload, bool) {
+			found = true
+		})
+	}
+	return found
+}
+
+var uploadType = reflect.TypeOf(Upload{})
+
+// findUploads calls found with the path of each Upload in v. shared is set
+// for uploads set by pointer.
+func findUploads(v reflect.Value, path string, found func(path string, u *Upload, shared bool)) {
+	if !v.IsValid() {
+		return
+	}
+	if v.Type() == uploadType {
+		u := v.Interface().(Upload)
+		found(path, &u, false)
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if v.Type().Elem() == uploadType {
+			found(path, v.Interface().(*Upload), true)
+			return
+		}
+		findUploads(v.Elem(), path, found)
+	case reflect.Interface:
+		findUploads(v.Elem(), path, found)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			findUploads(v.Index(i), path+"."+strconv.Itoa(i), found)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			findUploads(v.MapIndex(key), path+"."+key.String(), found)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if tag := field.Tag.Get("json"); tag != "" {
+				if tag == "-" {
+					continue
+				}
+				if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+					name = tagName
+				} else if field.Anonymous {
+					findUploads(v.Field(i), path, found)
+					continue
+				}
+			} else if field.Anonymous {
+				findUploads(v.Field(i), path, found)
+				continue
+			}
+			findUploads(v.Field(i), path+"."+name, found)
+		}
+	}
+}
+
+// runWithUploads sends req following the GraphQL multipart request spec.
+func (c *clientImp) runWithUploads(ctx context.Context, req *Request, uploads []*upload, resp interface{}) error {
+	operations, err := c.codec.Marshal(batchOperation{Query: req.q, Variables: req.vars})
+	if err != nil {
+		return errors.Wrap(err, "encode operations")
+	}
+	fileMap := make(map[string][]string, len(uploads))
+	for i, u := range uploads {
+		fileMap[strconv.Itoa(i)] = u.paths
+	}
+	mapField, err := c.codec.Marshal(fileMap)
+	if err != nil {
+		return errors.Wrap(err, "encode map")
+	}
+	body := newFormBody()
+	body.addField("operations", string(operations))
+	body.addField("map", string(mapField))
+	for i, u := range uploads {
+		body.addFile(strconv.Itoa(i), u.file, c.canRetry())
+	}
+	body.progress = req.progress
+	c.logf(">> operations: %s", operations)
+	c.logf(">> map: %s", mapField)
+	c.logf(">> files: %d", len(uploads))
+	r, err := body.request(c.endpoint)
+	if err != nil {
+		return err
+	}
+	r = c.prepareRequest(r, body.contentType(), req.Header)
+
+	r, err = c.withCacheKey(r, req)
+	if err != nil {
+		return err
+	}
+	return c.executeRequest(newResponseBody(resp), r)
+}
@@ -0,0 +1,105 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRunWithUploads(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.True(strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data"))
+		is.NoErr(r.ParseMultipartForm(1 << 20))
+		is.Equal(r.FormValue("operations"), `{"query":"mutation ($input: AlbumInput!) { createAlbum(input: $input) { id } }","variables":{"input":{"title":"Holidays","cover":null,"photos":[null,null]}}}`)
+		var fileMap map[string][]string
+		is.NoErr(json.Unmarshal([]byte(r.FormValue("map")), &fileMap))
+		is.Equal(fileMap, map[string][]string{
+			"0": {"variables.input.cover", "variables.input.photos.1"},
+			"1": {"variables.input.photos.0"},
+			"2": {"variables.extra"},
+		})
+		files := map[string]string{"0": "cover.jpg", "1": "beach.jpg", "2": "notes.txt"}
+		for field, name := range files {
+			file, header, err := r.FormFile(field)
+			is.NoErr(err)
+			is.Equal(header.Filename, name)
+			b, err := ioutil.ReadAll(file)
+			is.NoErr(err)
+			is.Equal(string(b), "contents of "+name)
+		}
+		io.WriteString(w, `{"data":{"createAlbum":{"id":"1"}}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec())
+
+	cover := &Upload{Name: "cover.jpg", R: strings.NewReader("contents of cover.jpg")}
+	req := NewRequest("mutation ($input: AlbumInput!) { createAlbum(input: $input) { id } }")
+	req.Var("input", struct {
+		Title  string        `json:"title"`
+		Cover  *Upload       `json:"cover"`
+		Photos []interface{} `json:"photos"`
+	}{
+		Title:  "Holidays",
+		Cover:  cover,
+		Photos: []interface{}{Upload{Name: "beach.jpg", R: strings.NewReader("contents of beach.jpg")}, cover},
+	})
+	req.File("variables.extra", "notes.txt", strings.NewReader("contents of notes.txt"))
+	var resp struct {
+		CreateAlbum struct {
+			ID string
+		}
+	}
+	is.NoErr(client.Run(ctx, req, &resp))
+	is.Equal(calls, 1)
+	is.Equal(resp.CreateAlbum.ID, "1")
+}
+
+func TestRunWithUploadsNoFiles(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.True(strings.HasPrefix(r.Header.Get("Content-Type"), "application/json"))
+		io.WriteString(w, `{"data":{"album":{"title":"Holidays"}}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec())
+	var resp map[string]interface{}
+	is.NoErr(client.Run(ctx, NewRequest("query { album { title } }"), &resp))
+}
+
+func TestRunWithUploadsWithoutSpec(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+	req := NewRequest("mutation ($f: Upload!) { upload(file: $f) }")
+	req.Var("f", []*Upload{{Name: "a.txt", R: strings.NewReader("a")}})
+	err := client.Run(ctx, req, nil)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "UseMultipartRequestSpec"))
+	is.True(client.RunBatch(ctx, []*Request{req}, nil) != nil)
+	is.Equal(calls, 0) // the file is not lost as null
+}